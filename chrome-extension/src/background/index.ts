@@ -6,20 +6,51 @@
  *
  * Handles:
  * - Terminal I/O (forwarding between side panel and native host PTY)
- * - Browser context requests (DOM, screenshots, console logs, etc.)
+ * - Browser context requests (DOM, screenshots, console logs, network, etc.)
+ * - Browser events (navigation, tab switches, console errors, selection)
  */
 
 import type {
   NativeMessage,
   BrowserContextRequest,
   BrowserContextResponse,
+  ApprovalRequestMessage,
+  ApprovalDecision,
+  BrowserEventMessage,
+  BrowserEventTopic,
   ExtensionMessage,
+  HelloMessage,
+  ProtocolErrorMessage,
 } from '../types/messages';
 
 const NATIVE_HOST_NAME = 'com.gemini.browser';
 
+// Native Messaging protocol spoken with the host (see native-host/protocol.go)
+const PROTOCOL_VERSION = 1;
+const MIN_PROTOCOL_VERSION = 1;
+const CAPABILITIES = [
+  'hello',
+  'protocol:error',
+  'host:ping',
+  'browser:request',
+  'browser:approval',
+  'terminal:output',
+  'terminal:inject',
+  'terminal:started',
+  'terminal:error',
+  'terminal:profiles',
+  'terminal:exit',
+  'terminal:recording',
+];
+// Hosts older than the handshake never send hello
+const HOST_HELLO_TIMEOUT_MS = 5000;
+
 let port: chrome.runtime.Port | null = null;
 let connectionStatus: 'connected' | 'disconnected' | 'connecting' | 'error' = 'disconnected';
+let hostHello: HelloMessage | null = null;
+let hostHelloTimer: ReturnType<typeof setTimeout> | null = null;
+// Kept so a side panel opened later still sees it
+let protocolError: ProtocolErrorMessage | null = null;
 
 // Console logs storage per tab (using debugger API)
 interface ConsoleLogEntry {
@@ -35,6 +66,37 @@ const consoleLogs = new Map<number, ConsoleLogEntry[]>();
 const attachedTabs = new Set<number>();
 const MAX_LOGS_PER_TAB = 500;
 
+// Network requests storage per tab (using debugger API)
+interface NetworkRequestEntry {
+  requestId: string;
+  url: string;
+  method: string;
+  resourceType: string;
+  status?: number;
+  statusText?: string;
+  mimeType?: string;
+  requestHeaders?: Record<string, string>;
+  responseHeaders?: Record<string, string>;
+  requestBody?: string;
+  responseBody?: string;
+  responseBodyTruncated?: boolean;
+  startTime: number;
+  durationMs?: number;
+  timing?: Record<string, number>;
+  encodedDataLength?: number;
+  finished: boolean;
+  failed: boolean;
+  errorText?: string;
+  // Monotonic debugger timestamp (seconds), used to compute durationMs
+  monotonicStart: number;
+}
+
+const networkRequests = new Map<number, Map<string, NetworkRequestEntry>>();
+const MAX_REQUESTS_PER_TAB = 500;
+const DEFAULT_MAX_BODY_SIZE = 100000;
+// Keep total body payload well under the 1MB Native Messaging limit
+const MAX_TOTAL_BODY_SIZE = 700000;
+
 /**
  * Connect to the native host
  */
@@ -59,6 +121,12 @@ function connectToNativeHost(): void {
       console.log('[Background] Native host disconnected:', error?.message);
       port = null;
       connectionStatus = 'disconnected';
+      hostHello = null;
+      protocolError = null;
+      if (hostHelloTimer !== null) {
+        clearTimeout(hostHelloTimer);
+        hostHelloTimer = null;
+      }
 
       if (error?.message?.includes('not found')) {
         broadcastToExtension({
@@ -77,6 +145,9 @@ function connectToNativeHost(): void {
     connectionStatus = 'connected';
     broadcastToExtension({ type: 'connection:status', status: 'connected' });
     console.log('[Background] Connected to native host');
+    sendHello().catch(error => console.error('[Background] Failed to send hello:', error));
+    publishActiveTab();
+
 
   } catch (error) {
     console.error('[Background] Failed to connect:', error);
@@ -89,6 +160,69 @@ function connectToNativeHost(): void {
   }
 }
 
+/**
+ * Id of this browser profile's extension, created on first use. Lets MCP
+ * clients tell the hosts of several profiles apart.
+ */
+async function getInstanceId(): Promise<string> {
+  const { instanceId } = await chrome.storage.local.get('instanceId');
+  if (typeof instanceId === 'string' && instanceId) {
+    return instanceId;
+  }
+  const id = crypto.randomUUID();
+  await chrome.storage.local.set({ instanceId: id });
+  return id;
+}
+
+/**
+ * Name of the browser we run in (Chrome, Brave, Edge, ...)
+ */
+function getBrowserName(): string {
+  if ((navigator as Navigator & { brave?: unknown }).brave) {
+    return 'Brave';
+  }
+  const brands = (navigator as Navigator & { userAgentData?: { brands: Array<{ brand: string }> } })
+    .userAgentData?.brands ?? [];
+  const brand = brands.find(b => b.brand !== 'Chromium' && !b.brand.includes('Not'));
+  return brand?.brand ?? 'Chromium';
+}
+
+/**
+ * Announce our protocol version and capabilities, and flag hosts that
+ * don't answer with theirs
+ */
+async function sendHello(): Promise<void> {
+  const hello: HelloMessage = {
+    type: 'hello',
+    protocolVersion: PROTOCOL_VERSION,
+    minProtocolVersion: MIN_PROTOCOL_VERSION,
+    capabilities: CAPABILITIES,
+    version: chrome.runtime.getManifest().version,
+    instanceId: await getInstanceId(),
+    browser: getBrowserName()
+  };
+  sendToNativeHost(hello);
+
+  hostHelloTimer = setTimeout(() => {
+    hostHelloTimer = null;
+    if (port !== null && hostHello === null) {
+      reportProtocolError({
+        type: 'protocol:error',
+        error: `The native host did not announce a protocol version; it is older than this extension (protocol v${PROTOCOL_VERSION}). Re-run install.sh to update it.`
+      });
+    }
+  }, HOST_HELLO_TIMEOUT_MS);
+}
+
+/**
+ * Show a protocol error in the side panel
+ */
+function reportProtocolError(message: ProtocolErrorMessage): void {
+  console.error('[Background] Protocol error:', message.error);
+  protocolError = message;
+  broadcastToExtension(message);
+}
+
 /**
  * Send message to native host
  */
@@ -101,6 +235,30 @@ function sendToNativeHost(message: NativeMessage): boolean {
   return true;
 }
 
+/**
+ * Publish a browser event to the native host (dropped while disconnected)
+ */
+function publishBrowserEvent(topic: BrowserEventTopic, data: Record<string, unknown>): void {
+  if (port === null) return;
+  const event: BrowserEventMessage = { type: 'browser:event', topic, data };
+  port.postMessage(event);
+}
+
+/**
+ * Publish the focused window's active tab, so the host knows which page
+ * its cached reads belong to
+ */
+async function publishActiveTab(): Promise<void> {
+  try {
+    const [tab] = await chrome.tabs.query({ active: true, currentWindow: true });
+    if (tab?.id !== undefined) {
+      publishBrowserEvent('tab', { tabId: tab.id, url: tab.url, title: tab.title });
+    }
+  } catch {
+    // No window open
+  }
+}
+
 /**
  * Broadcast message to all extension contexts (side panel)
  */
@@ -116,17 +274,100 @@ function broadcastToExtension(message: ExtensionMessage | NativeMessage): void {
 async function handleNativeMessage(message: NativeMessage): Promise<void> {
   switch (message.type) {
     case 'terminal:output':
-      // Forward terminal output to side panel
+    case 'terminal:inject':
+    case 'terminal:started':
+    case 'terminal:error':
+    case 'terminal:profiles':
+    case 'terminal:exit':
+    case 'terminal:recording':
+      // Forward terminal output and session status to side panel
       broadcastToExtension(message);
       break;
 
+    case 'hello':
+      // The host checks compatibility and sends protocol:error on a mismatch
+      hostHello = message as HelloMessage;
+      if (hostHelloTimer !== null) {
+        clearTimeout(hostHelloTimer);
+        hostHelloTimer = null;
+      }
+      console.log('[Background] Native host', hostHello.version, 'protocol', hostHello.protocolVersion);
+      break;
+
+    case 'protocol:error':
+      reportProtocolError(message as ProtocolErrorMessage);
+      break;
+
+    case 'host:ping':
+      // Liveness check: the host fails requests fast when these stop
+      sendToNativeHost({ type: 'host:pong', requestId: message.requestId });
+      break;
+
     case 'browser:request':
       // Native host is requesting browser context
       await handleBrowserContextRequest(message as BrowserContextRequest);
       break;
 
+    case 'browser:approval':
+      // Policy engine needs the user to approve an action
+      await handleApprovalRequest(message as ApprovalRequestMessage);
+      break;
+
     default:
-      console.log('[Background] Unknown message type:', message.type);
+      console.warn('[Background] Unknown message type:', message.type,
+        `(extension protocol v${PROTOCOL_VERSION}, host protocol v${hostHello?.protocolVersion ?? 'unknown'})`);
+  }
+}
+
+/**
+ * Ask the side panel to approve an action and report the decision to the native host
+ */
+async function handleApprovalRequest(request: ApprovalRequestMessage): Promise<void> {
+  console.log('[Background] Approval request:', request.action, request.params?.origin);
+
+  let decision: ApprovalDecision = { approved: false, remember: false };
+  let error: string | undefined;
+
+  try {
+    const reply = await chrome.runtime.sendMessage(request) as ApprovalDecision | undefined;
+    if (reply) {
+      decision = reply;
+    } else {
+      error = 'No approval received from side panel';
+    }
+  } catch {
+    error = 'Side panel is not open to approve this action';
+  }
+
+  sendToNativeHost({
+    type: 'browser:approval',
+    requestId: request.requestId,
+    success: decision.approved,
+    data: { remember: decision.remember },
+    error
+  });
+}
+
+// Actions the native host may answer from its cache (CacheConfig.TTLSeconds)
+const CACHEABLE_ACTIONS = new Set(['getPageText', 'getDom', 'inspectPage']);
+
+// Tabs whose content script is watching for the first DOM change
+const watchedTabs = new Set<number>();
+
+/**
+ * Ask the tab's content script to report its next DOM change, before a
+ * read the host may cache. Pages without the content script (opened before
+ * the extension loaded) get a new page token instead, so the host doesn't
+ * keep a read it would never hear is stale.
+ */
+async function watchPage(request: BrowserContextRequest): Promise<void> {
+  const tab = await getActiveTab(request).catch(() => undefined);
+  if (tab?.id === undefined || watchedTabs.has(tab.id)) return;
+  try {
+    await chrome.tabs.sendMessage(tab.id, { type: 'page:watch' }, { frameId: 0 });
+    watchedTabs.add(tab.id);
+  } catch {
+    publishBrowserEvent('page', { tabId: tab.id, url: tab.url, token: Date.now() });
   }
 }
 
@@ -139,6 +380,10 @@ async function handleBrowserContextRequest(request: BrowserContextRequest): Prom
   try {
     let response: BrowserContextResponse;
 
+    if (CACHEABLE_ACTIONS.has(request.action)) {
+      await watchPage(request);
+    }
+
     switch (request.action) {
       case 'getDom':
         response = await getActiveTabDom(request);
@@ -170,6 +415,12 @@ async function handleBrowserContextRequest(request: BrowserContextRequest): Prom
       case 'getPageForDownload':
         response = await getPageForDownload(request);
         break;
+      case 'getNetworkRequests':
+        response = await getNetworkRequests(request);
+        break;
+      case 'clearNetworkLog':
+        response = await clearNetworkLog(request);
+        break;
       default:
         response = {
           type: 'browser:response',
@@ -192,10 +443,25 @@ async function handleBrowserContextRequest(request: BrowserContextRequest): Prom
 }
 
 /**
- * Get the active tab
+ * Get the active tab, or the tab the host checked its policy against. A
+ * pinned tab that has moved to another origin since is refused, so an
+ * approval for one site can't be used on another.
  */
-async function getActiveTab(): Promise<chrome.tabs.Tab> {
-  const [tab] = await chrome.tabs.query({ active: true, currentWindow: true });
+async function getActiveTab(request?: BrowserContextRequest): Promise<chrome.tabs.Tab> {
+  const pinned = pinnedTarget(request);
+  let tab: chrome.tabs.Tab | undefined;
+  if (pinned) {
+    tab = await chrome.tabs.get(pinned.tabId).catch(() => undefined);
+    if (!tab) {
+      throw new Error('The tab this action was approved for has been closed');
+    }
+    const origin = originOf(tab.url || '');
+    if (origin !== pinned.origin) {
+      throw new Error(`The tab moved from ${pinned.origin} to ${origin} after this action was approved`);
+    }
+  } else {
+    [tab] = await chrome.tabs.query({ active: true, currentWindow: true });
+  }
   if (!tab?.id) {
     throw new Error('No active tab found');
   }
@@ -210,11 +476,30 @@ async function getActiveTab(): Promise<chrome.tabs.Tab> {
   return tab;
 }
 
+/**
+ * The tab and origin the host pinned a request to (targetTabId/targetUrl)
+ */
+function pinnedTarget(request?: BrowserContextRequest): { tabId: number; origin: string } | null {
+  const params = request?.params as { targetTabId?: number; targetUrl?: string } | undefined;
+  if (typeof params?.targetTabId !== 'number') {
+    return null;
+  }
+  return { tabId: params.targetTabId, origin: originOf(params.targetUrl || '') };
+}
+
+function originOf(url: string): string {
+  try {
+    return new URL(url).origin;
+  } catch {
+    return url;
+  }
+}
+
 /**
  * Get DOM from active tab
  */
 async function getActiveTabDom(request: BrowserContextRequest): Promise<BrowserContextResponse> {
-  const tab = await getActiveTab();
+  const tab = await getActiveTab(request);
 
   const results = await chrome.scripting.executeScript({
     target: { tabId: tab.id! },
@@ -256,7 +541,7 @@ async function getActiveTabDom(request: BrowserContextRequest): Promise<BrowserC
  * Get selected text from active tab
  */
 async function getActiveTabSelection(request: BrowserContextRequest): Promise<BrowserContextResponse> {
-  const tab = await getActiveTab();
+  const tab = await getActiveTab(request);
 
   const results = await chrome.scripting.executeScript({
     target: { tabId: tab.id! },
@@ -282,7 +567,7 @@ async function getActiveTabSelection(request: BrowserContextRequest): Promise<Br
  * Get URL of active tab
  */
 async function getActiveTabUrl(request: BrowserContextRequest): Promise<BrowserContextResponse> {
-  const tab = await getActiveTab();
+  const tab = await getActiveTab(request);
 
   return {
     type: 'browser:response',
@@ -298,13 +583,33 @@ async function getActiveTabUrl(request: BrowserContextRequest): Promise<BrowserC
 
 /**
  * Capture screenshot of active tab
+ *
+ * The visible viewport in PNG/JPEG uses captureVisibleTab. Full page, element
+ * clips and WebP go through the debugger's Page.captureScreenshot.
  */
 async function captureActiveTabScreenshot(request: BrowserContextRequest): Promise<BrowserContextResponse> {
+  const params = request.params as {
+    fullPage?: boolean;
+    selector?: string;
+    format?: 'png' | 'jpeg' | 'webp';
+    quality?: number;
+  } || {};
+
+  const format = params.format || 'png';
+  const quality = params.quality ?? 90;
+
   try {
-    const dataUrl = await chrome.tabs.captureVisibleTab({
-      format: 'png',
-      quality: 90
-    });
+    let dataUrl: string;
+
+    if (params.fullPage || params.selector || format === 'webp') {
+      const tab = await getActiveTab(request);
+      dataUrl = await captureWithDebugger(tab.id!, format, quality, params.fullPage ?? false, params.selector);
+    } else {
+      dataUrl = await chrome.tabs.captureVisibleTab({
+        format: format as 'png' | 'jpeg',
+        quality
+      });
+    }
 
     return {
       type: 'browser:response',
@@ -312,7 +617,7 @@ async function captureActiveTabScreenshot(request: BrowserContextRequest): Promi
       success: true,
       data: {
         dataUrl,
-        format: 'png'
+        format
       }
     };
   } catch (error) {
@@ -325,11 +630,74 @@ async function captureActiveTabScreenshot(request: BrowserContextRequest): Promi
   }
 }
 
+/**
+ * Capture a screenshot through the debugger (full page or element clip)
+ */
+async function captureWithDebugger(
+  tabId: number,
+  format: string,
+  quality: number,
+  fullPage: boolean,
+  selector?: string
+): Promise<string> {
+  if (!attachedTabs.has(tabId)) {
+    await attachDebuggerToTab(tabId);
+  }
+
+  let clip: { x: number; y: number; width: number; height: number; scale: number } | undefined;
+
+  if (selector) {
+    const results = await chrome.scripting.executeScript({
+      target: { tabId },
+      func: (sel: string) => {
+        const element = document.querySelector(sel);
+        if (!element) {
+          return { error: `Element not found: ${sel}` };
+        }
+        element.scrollIntoView({ block: 'nearest', inline: 'nearest' });
+        const rect = element.getBoundingClientRect();
+        return {
+          x: rect.left + window.scrollX,
+          y: rect.top + window.scrollY,
+          width: rect.width,
+          height: rect.height
+        };
+      },
+      args: [selector]
+    });
+
+    const rect = results[0]?.result as { x: number; y: number; width: number; height: number; error?: string } | undefined;
+    if (!rect || rect.error) {
+      throw new Error(rect?.error || `Element not found: ${selector}`);
+    }
+    if (rect.width === 0 || rect.height === 0) {
+      throw new Error(`Element has no visible size: ${selector}`);
+    }
+    clip = { ...rect, scale: 1 };
+  } else if (fullPage) {
+    const metrics = await chrome.debugger.sendCommand({ tabId }, 'Page.getLayoutMetrics') as {
+      cssContentSize?: { width: number; height: number };
+      contentSize: { width: number; height: number };
+    };
+    const size = metrics.cssContentSize || metrics.contentSize;
+    clip = { x: 0, y: 0, width: Math.ceil(size.width), height: Math.ceil(size.height), scale: 1 };
+  }
+
+  const result = await chrome.debugger.sendCommand({ tabId }, 'Page.captureScreenshot', {
+    format,
+    quality: format === 'png' ? undefined : quality,
+    clip,
+    captureBeyondViewport: clip !== undefined
+  }) as { data: string };
+
+  return `data:image/${format};base64,${result.data}`;
+}
+
 /**
  * Execute script in active tab
  */
 async function executeScriptInTab(request: BrowserContextRequest): Promise<BrowserContextResponse> {
-  const tab = await getActiveTab();
+  const tab = await getActiveTab(request);
   const script = (request.params as { script?: string })?.script;
 
   if (!script) {
@@ -346,7 +714,11 @@ async function executeScriptInTab(request: BrowserContextRequest): Promise<Brows
     const results = await chrome.scripting.executeScript({
       target: { tabId: tab.id! },
       world: 'MAIN',
-      func: (code: string) => {
+      func: (code: string, expectedOrigin: string | null) => {
+        // The page may have navigated since the tab was checked
+        if (expectedOrigin !== null && location.origin !== expectedOrigin) {
+          return { success: false, error: `The page moved to ${location.origin} after this action was approved` };
+        }
         try {
           // Use Function constructor to execute and return result
           const fn = new Function(code);
@@ -355,7 +727,7 @@ async function executeScriptInTab(request: BrowserContextRequest): Promise<Brows
           return { success: false, error: e instanceof Error ? e.message : 'Script error' };
         }
       },
-      args: [script]
+      args: [script, pinnedTarget(request)?.origin ?? null]
     });
 
     const result = results[0]?.result;
@@ -388,7 +760,7 @@ async function executeScriptInTab(request: BrowserContextRequest): Promise<Brows
  * Modify DOM elements in active tab
  */
 async function modifyDomInTab(request: BrowserContextRequest): Promise<BrowserContextResponse> {
-  const tab = await getActiveTab();
+  const tab = await getActiveTab(request);
 
   const params = request.params as {
     selector?: string;
@@ -410,7 +782,10 @@ async function modifyDomInTab(request: BrowserContextRequest): Promise<BrowserCo
   try {
     const results = await chrome.scripting.executeScript({
       target: { tabId: tab.id! },
-      func: (selector: string, action: string, value: string | null, attributeName: string | null, all: boolean) => {
+      func: (selector: string, action: string, value: string | null, attributeName: string | null, all: boolean, expectedOrigin: string | null) => {
+        if (expectedOrigin !== null && location.origin !== expectedOrigin) {
+          return { success: false, error: `The page moved to ${location.origin} after this action was approved` };
+        }
         try {
           const elements = all
             ? Array.from(document.querySelectorAll(selector))
@@ -467,7 +842,7 @@ async function modifyDomInTab(request: BrowserContextRequest): Promise<BrowserCo
           return { success: false, error: e instanceof Error ? e.message : 'DOM modification failed' };
         }
       },
-      args: [params.selector, params.action, params.value ?? null, params.attributeName ?? null, params.all ?? false]
+      args: [params.selector, params.action, params.value ?? null, params.attributeName ?? null, params.all ?? false, pinnedTarget(request)?.origin ?? null]
     });
 
     const result = results[0]?.result;
@@ -505,16 +880,18 @@ async function attachDebuggerToTab(tabId: number): Promise<void> {
   await chrome.debugger.attach({ tabId }, '1.3');
   attachedTabs.add(tabId);
   consoleLogs.set(tabId, []);
+  networkRequests.set(tabId, new Map());
 
   await chrome.debugger.sendCommand({ tabId }, 'Log.enable');
   await chrome.debugger.sendCommand({ tabId }, 'Runtime.enable');
+  await chrome.debugger.sendCommand({ tabId }, 'Network.enable');
 }
 
 /**
  * Get console logs for active tab
  */
 async function getConsoleLogs(request: BrowserContextRequest): Promise<BrowserContextResponse> {
-  const tab = await getActiveTab();
+  const tab = await getActiveTab(request);
   const tabId = tab.id!;
 
   const params = request.params as {
@@ -565,11 +942,166 @@ async function getConsoleLogs(request: BrowserContextRequest): Promise<BrowserCo
   };
 }
 
+/**
+ * Check whether a network entry matches the status filter ("404", "4xx" or "failed")
+ */
+function matchesStatus(entry: NetworkRequestEntry, status: string): boolean {
+  if (status === 'failed') {
+    return entry.failed;
+  }
+  if (entry.status === undefined) {
+    return false;
+  }
+  const match = /^([1-5])xx$/i.exec(status);
+  if (match) {
+    return Math.floor(entry.status / 100) === Number(match[1]);
+  }
+  return String(entry.status) === status;
+}
+
+/**
+ * Get captured network requests for active tab
+ */
+async function getNetworkRequests(request: BrowserContextRequest): Promise<BrowserContextResponse> {
+  const tab = await getActiveTab(request);
+  const tabId = tab.id!;
+
+  const params = request.params as {
+    urlPattern?: string;
+    status?: string | number;
+    resourceType?: string;
+    includeBodies?: boolean;
+    maxBodySize?: number;
+    limit?: number;
+  } || {};
+
+  if (!attachedTabs.has(tabId)) {
+    try {
+      await attachDebuggerToTab(tabId);
+      await new Promise(resolve => setTimeout(resolve, 100));
+    } catch (error) {
+      return {
+        type: 'browser:response',
+        requestId: request.requestId,
+        success: false,
+        error: `Failed to attach debugger: ${error instanceof Error ? error.message : 'Unknown error'}`
+      };
+    }
+  }
+
+  let entries = Array.from(networkRequests.get(tabId)?.values() || []);
+
+  if (params.urlPattern) {
+    const pattern = params.urlPattern;
+    if (pattern.length > 2 && pattern.startsWith('/') && pattern.endsWith('/')) {
+      const re = new RegExp(pattern.slice(1, -1), 'i');
+      entries = entries.filter(e => re.test(e.url));
+    } else {
+      const needle = pattern.toLowerCase();
+      entries = entries.filter(e => e.url.toLowerCase().includes(needle));
+    }
+  }
+
+  if (params.status !== undefined && params.status !== '') {
+    const status = String(params.status);
+    entries = entries.filter(e => matchesStatus(e, status));
+  }
+
+  if (params.resourceType) {
+    const type = params.resourceType.toLowerCase();
+    entries = entries.filter(e => e.resourceType.toLowerCase() === type);
+  }
+
+  const total = entries.length;
+  const limit = params.limit || 100;
+  if (entries.length > limit) {
+    entries = entries.slice(entries.length - limit);
+  }
+
+  const maxBodySize = params.maxBodySize || DEFAULT_MAX_BODY_SIZE;
+  let bodyBudget = MAX_TOTAL_BODY_SIZE;
+
+  const requests = [];
+  for (const entry of entries) {
+    const { monotonicStart: _monotonicStart, ...out } = entry;
+
+    if (params.includeBodies && entry.finished && !entry.failed) {
+      try {
+        const body = await chrome.debugger.sendCommand({ tabId }, 'Network.getResponseBody', {
+          requestId: entry.requestId
+        }) as { body: string; base64Encoded: boolean };
+
+        let text = body.body;
+        let truncated = false;
+        let limitForEntry = Math.min(maxBodySize, bodyBudget);
+        if (body.base64Encoded) {
+          // Cut on a 4-character group so the kept part still decodes
+          limitForEntry -= limitForEntry % 4;
+        }
+        if (text.length > limitForEntry) {
+          text = text.substring(0, limitForEntry);
+          truncated = true;
+        }
+        bodyBudget -= text.length;
+        out.responseBody = body.base64Encoded ? `base64:${text}` : text;
+        out.responseBodyTruncated = truncated;
+      } catch {
+        // Body no longer available (evicted by Chrome or redirect)
+      }
+    }
+
+    if (!params.includeBodies) {
+      delete out.requestBody;
+    }
+
+    requests.push(out);
+  }
+
+  return {
+    type: 'browser:response',
+    requestId: request.requestId,
+    success: true,
+    data: {
+      requests,
+      total,
+      returned: requests.length,
+      tabId,
+      url: tab.url,
+      isCapturing: attachedTabs.has(tabId)
+    }
+  };
+}
+
+/**
+ * Clear captured network requests for active tab
+ */
+async function clearNetworkLog(request: BrowserContextRequest): Promise<BrowserContextResponse> {
+  const tab = await getActiveTab(request);
+  const tabId = tab.id!;
+
+  const cleared = networkRequests.get(tabId)?.size || 0;
+  if (networkRequests.has(tabId)) {
+    networkRequests.set(tabId, new Map());
+  }
+
+  return {
+    type: 'browser:response',
+    requestId: request.requestId,
+    success: true,
+    data: {
+      cleared,
+      tabId,
+      url: tab.url,
+      isCapturing: attachedTabs.has(tabId)
+    }
+  };
+}
+
 /**
  * Get page content for downloading to file (text or cleaned HTML)
  */
 async function getPageForDownload(request: BrowserContextRequest): Promise<BrowserContextResponse> {
-  const tab = await getActiveTab();
+  const tab = await getActiveTab(request);
 
   const params = request.params as { format?: 'text' | 'html' | 'markdown' };
   const format = params.format || 'text';
@@ -649,7 +1181,7 @@ async function getPageForDownload(request: BrowserContextRequest): Promise<Brows
  * Get page text content (much smaller than full DOM)
  */
 async function getPageText(request: BrowserContextRequest): Promise<BrowserContextResponse> {
-  const tab = await getActiveTab();
+  const tab = await getActiveTab(request);
 
   const params = request.params as { selector?: string; maxLength?: number };
 
@@ -705,7 +1237,7 @@ async function getPageText(request: BrowserContextRequest): Promise<BrowserConte
  * Inspect page complexity
  */
 async function inspectPage(request: BrowserContextRequest): Promise<BrowserContextResponse> {
-  const tab = await getActiveTab();
+  const tab = await getActiveTab(request);
 
   const results = await chrome.scripting.executeScript({
     target: { tabId: tab.id! },
@@ -789,7 +1321,15 @@ chrome.debugger.onEvent.addListener((source, method, params) => {
     };
   }
 
+  if (method.startsWith('Network.')) {
+    handleNetworkEvent(tabId, method, params);
+    return;
+  }
+
   if (entry) {
+    if (entry.level === 'error' || entry.level === 'warning') {
+      publishBrowserEvent('console', { tabId, ...entry });
+    }
     const logs = consoleLogs.get(tabId) || [];
     logs.push(entry);
     if (logs.length > MAX_LOGS_PER_TAB) {
@@ -799,6 +1339,75 @@ chrome.debugger.onEvent.addListener((source, method, params) => {
   }
 });
 
+/**
+ * Record a Network.* debugger event for the tab
+ */
+function handleNetworkEvent(tabId: number, method: string, params: unknown): void {
+  const requests = networkRequests.get(tabId);
+  if (!requests) return;
+
+  if (method === 'Network.requestWillBeSent') {
+    const event = params as {
+      requestId: string;
+      type?: string;
+      timestamp: number;
+      wallTime: number;
+      request: { url: string; method: string; headers: Record<string, string>; postData?: string };
+    };
+    requests.set(event.requestId, {
+      requestId: event.requestId,
+      url: event.request.url,
+      method: event.request.method,
+      resourceType: event.type || 'Other',
+      requestHeaders: event.request.headers,
+      requestBody: event.request.postData,
+      startTime: Math.round(event.wallTime * 1000),
+      monotonicStart: event.timestamp,
+      finished: false,
+      failed: false
+    });
+    if (requests.size > MAX_REQUESTS_PER_TAB) {
+      const oldest = requests.keys().next().value;
+      if (oldest !== undefined) requests.delete(oldest);
+    }
+    return;
+  }
+
+  const requestId = (params as { requestId?: string }).requestId;
+  const entry = requestId ? requests.get(requestId) : undefined;
+  if (!entry) return;
+
+  if (method === 'Network.responseReceived') {
+    const event = params as {
+      type?: string;
+      response: {
+        status: number;
+        statusText: string;
+        mimeType: string;
+        headers: Record<string, string>;
+        timing?: Record<string, number>;
+      };
+    };
+    entry.status = event.response.status;
+    entry.statusText = event.response.statusText;
+    entry.mimeType = event.response.mimeType;
+    entry.responseHeaders = event.response.headers;
+    entry.timing = event.response.timing;
+    if (event.type) entry.resourceType = event.type;
+  } else if (method === 'Network.loadingFinished') {
+    const event = params as { timestamp: number; encodedDataLength: number };
+    entry.finished = true;
+    entry.encodedDataLength = event.encodedDataLength;
+    entry.durationMs = Math.round((event.timestamp - entry.monotonicStart) * 1000);
+  } else if (method === 'Network.loadingFailed') {
+    const event = params as { timestamp: number; errorText: string; canceled?: boolean };
+    entry.finished = true;
+    entry.failed = true;
+    entry.errorText = event.canceled ? 'canceled' : event.errorText;
+    entry.durationMs = Math.round((event.timestamp - entry.monotonicStart) * 1000);
+  }
+}
+
 // Clean up on debugger detach
 chrome.debugger.onDetach.addListener((source) => {
   if (source.tabId) {
@@ -806,21 +1415,88 @@ chrome.debugger.onDetach.addListener((source) => {
   }
 });
 
+// Publish navigation of the active tab
+chrome.tabs.onUpdated.addListener((tabId, changeInfo, tab) => {
+  // A watched tab that reloads or navigates in the background loses its
+  // content script's observer; tell the host its reads are stale
+  if (watchedTabs.has(tabId) && (changeInfo.url || changeInfo.status === 'loading')) {
+    watchedTabs.delete(tabId);
+    publishBrowserEvent('page', { tabId, url: tab.url, token: Date.now() });
+  }
+  if (!tab.active || (!changeInfo.url && changeInfo.status !== 'complete')) return;
+  publishBrowserEvent('navigation', {
+    tabId,
+    url: tab.url,
+    title: tab.title,
+    status: changeInfo.status ?? tab.status
+  });
+});
+
+// Publish tab switches
+chrome.tabs.onActivated.addListener(async ({ tabId }) => {
+  try {
+    const tab = await chrome.tabs.get(tabId);
+    publishBrowserEvent('tab', { tabId, url: tab.url, title: tab.title });
+  } catch {
+    // Tab closed before we could read it
+  }
+});
+
+// Switching windows switches the active tab too
+chrome.windows.onFocusChanged.addListener((windowId) => {
+  if (windowId !== chrome.windows.WINDOW_ID_NONE) {
+    publishActiveTab();
+  }
+});
+
 // Clean up on tab close
 chrome.tabs.onRemoved.addListener((tabId) => {
   attachedTabs.delete(tabId);
   consoleLogs.delete(tabId);
+  networkRequests.delete(tabId);
+  watchedTabs.delete(tabId);
+  publishBrowserEvent('tab', { tabId, closed: true });
 });
 
-// Listen for messages from side panel
-chrome.runtime.onMessage.addListener((message: ExtensionMessage, _sender, sendResponse) => {
+// Listen for messages from side panel and content scripts
+chrome.runtime.onMessage.addListener((message: ExtensionMessage, sender, sendResponse) => {
+  if (message.type === 'page:selection') {
+    // Only the active tab's selection is interesting
+    if (sender.tab?.active) {
+      publishBrowserEvent('selection', {
+        tabId: sender.tab.id,
+        url: sender.tab.url,
+        text: message.text
+      });
+    }
+    return false;
+  }
+
+  if (message.type === 'page:changed') {
+    // A new token tells the host its cached reads of the page are stale
+    if (sender.tab?.id !== undefined) {
+      watchedTabs.delete(sender.tab.id);
+      publishBrowserEvent('page', {
+        tabId: sender.tab.id,
+        url: sender.tab.url,
+        token: Date.now()
+      });
+    }
+    return false;
+  }
+
   if (message.type === 'ping') {
     sendResponse({ type: 'pong', connectionStatus });
-    setTimeout(() => broadcastToExtension({ type: 'connection:status', status: connectionStatus }), 100);
+    setTimeout(() => {
+      broadcastToExtension({ type: 'connection:status', status: connectionStatus });
+      if (protocolError) {
+        broadcastToExtension(protocolError);
+      }
+    }, 100);
     return true;
   }
 
-  if (message.type === 'terminal:input' || message.type === 'terminal:resize') {
+  if (message.type.startsWith('terminal:')) {
     sendToNativeHost(message as NativeMessage);
     sendResponse({ success: true });
     return true;
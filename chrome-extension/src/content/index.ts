@@ -1,8 +1,62 @@
 /**
  * Content Script
  * Runs in the context of web pages
- * Currently minimal - most functionality is handled via chrome.scripting API
+ * Most functionality is handled via chrome.scripting API; this script only
+ * reports selection changes so the native host can publish selection events,
+ * and, while the host holds cached reads of the page, the first DOM change
+ * so it knows they are stale.
  */
 
+const SELECTION_DEBOUNCE_MS = 500;
+const MAX_SELECTION_LENGTH = 2000;
+
+let selectionTimer: ReturnType<typeof setTimeout> | undefined;
+let lastSelection = '';
+
+document.addEventListener('selectionchange', () => {
+  clearTimeout(selectionTimer);
+  selectionTimer = setTimeout(() => {
+    const text = (window.getSelection()?.toString() || '').slice(0, MAX_SELECTION_LENGTH);
+    if (text === lastSelection) return;
+    lastSelection = text;
+    chrome.runtime.sendMessage({ type: 'page:selection', text }).catch(() => {
+      // Extension reloaded or service worker unavailable
+    });
+  }, SELECTION_DEBOUNCE_MS);
+});
+
+// Watch for the first DOM change once the background says the page was
+// read for the cache (page:watch). One report is enough: it drops the
+// cached reads, and the next read arms the observer again. Attribute
+// changes (hover states, animations) rarely change what the readers return.
+let pageObserver: MutationObserver | undefined;
+
+function watchPage(): void {
+  if (pageObserver) return;
+  pageObserver = new MutationObserver(() => {
+    pageObserver?.disconnect();
+    pageObserver = undefined;
+    chrome.runtime.sendMessage({ type: 'page:changed' }).catch(() => {
+      // Extension reloaded or service worker unavailable
+    });
+  });
+  pageObserver.observe(document, {
+    childList: true,
+    subtree: true,
+    characterData: true
+  });
+}
+
+// Cached reads are of the top frame only
+if (window === window.top) {
+  chrome.runtime.onMessage.addListener((message: { type?: string }, _sender, sendResponse) => {
+    if (message.type === 'page:watch') {
+      watchPage();
+      sendResponse({ watching: true });
+    }
+    return false;
+  });
+}
+
 // Notify that content script is loaded
 console.log('[Chrome Gemini Sync] Content script loaded');
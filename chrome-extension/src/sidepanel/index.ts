@@ -6,7 +6,15 @@
 import { Terminal } from '@xterm/xterm';
 import { FitAddon } from '@xterm/addon-fit';
 import { WebLinksAddon } from '@xterm/addon-web-links';
-import type { NativeMessage, ConnectionStatusMessage } from '../types/messages';
+import type {
+  NativeMessage,
+  TerminalProfilesMessage,
+  TerminalExitMessage,
+  TerminalRecordingMessage,
+  ConnectionStatusMessage,
+  ApprovalRequestMessage,
+  ApprovalDecision,
+} from '../types/messages';
 
 // Terminal instance
 let terminal: Terminal;
@@ -15,6 +23,10 @@ let fitAddon: FitAddon;
 // Connection state
 let isConnected = false;
 
+// Set when the terminal process has exited and won't be restarted by the
+// host; the next keypress restarts it
+let sessionExited = false;
+
 // Debounce resize
 let resizeTimeout: ReturnType<typeof setTimeout> | null = null;
 
@@ -82,7 +94,10 @@ function initTerminal(): void {
 
   // Handle terminal input
   terminal.onData((data) => {
-    if (isConnected) {
+    if (isConnected && sessionExited) {
+      sessionExited = false;
+      sendMessage({ type: 'terminal:restart' });
+    } else if (isConnected) {
       sendMessage({
         type: 'terminal:input',
         data
@@ -90,6 +105,21 @@ function initTerminal(): void {
     }
   });
 
+  // Send pastes as such: the native host adds bracketed-paste markers when
+  // the program wants them and writes large pastes in chunks. Captured on
+  // the container so xterm.js doesn't also handle it.
+  container.addEventListener('paste', (event) => {
+    const text = event.clipboardData?.getData('text/plain');
+    if (!text || !isConnected || sessionExited) return;
+    event.preventDefault();
+    event.stopPropagation();
+    sendMessage({
+      type: 'terminal:input',
+      data: text.replace(/\r?\n/g, '\r'),
+      paste: true
+    });
+  }, true);
+
   // Handle resize with debouncing
   const debouncedResize = () => {
     if (resizeTimeout) {
@@ -168,6 +198,8 @@ function updateConnectionStatus(status: 'connected' | 'disconnected' | 'connecti
       isConnected = true;
       // Send initial resize
       setTimeout(sendResize, 100);
+      sendMessage({ type: 'terminal:profiles' });
+      sendMessage({ type: 'terminal:recording', params: { action: 'status' } });
     } else {
       overlay.classList.remove('hidden');
       isConnected = false;
@@ -206,6 +238,41 @@ function handleMessage(message: NativeMessage): void {
       }
       break;
 
+    case 'terminal:inject':
+      if (terminal && !message.success) {
+        terminal.writeln(`\r\n\x1b[1;31m✗ Could not send page context: ${message.error || 'unknown error'}\x1b[0m`);
+      }
+      terminal?.focus();
+      break;
+
+    case 'terminal:started': {
+      const { profile, cwd } = (message.data || {}) as { profile?: string; cwd?: string };
+      sessionExited = false;
+      selectProfile(profile);
+      selectWorkspace(cwd);
+      break;
+    }
+
+    case 'terminal:error':
+      terminal?.writeln(`\r\n\x1b[1;31m✗ ${message.error}\x1b[0m`);
+      break;
+
+    case 'terminal:exit':
+      showExit(message as TerminalExitMessage);
+      break;
+
+    case 'terminal:recording':
+      showRecording(message as TerminalRecordingMessage);
+      break;
+
+    case 'terminal:profiles':
+      showProfiles(message as TerminalProfilesMessage);
+      break;
+
+    case 'protocol:error':
+      terminal?.writeln(`\r\n\x1b[1;31m✗ ${message.error}\x1b[0m`);
+      break;
+
     case 'connection:status':
       const statusMessage = message as unknown as ConnectionStatusMessage;
       updateConnectionStatus(statusMessage.status, statusMessage.message);
@@ -216,13 +283,145 @@ function handleMessage(message: NativeMessage): void {
   }
 }
 
+/**
+ * Report how the terminal process ended and whether it will come back
+ */
+function showExit(message: TerminalExitMessage): void {
+  if (!terminal) return;
+  const { code, signal, restartInMs, reason } = message.data;
+  const status = signal ? `killed by ${signal}` : `exited with code ${code}`;
+  const color = signal || code !== 0 ? '31' : '90';
+
+  terminal.writeln('');
+  terminal.writeln(`\x1b[1;${color}m[Process ${status}]\x1b[0m`);
+  if (restartInMs !== undefined) {
+    terminal.writeln(`\x1b[90mRestarting in ${(restartInMs / 1000).toFixed(1)}s...\x1b[0m`);
+    return;
+  }
+  if (reason) {
+    terminal.writeln(`\x1b[90m${reason}\x1b[0m`);
+  }
+  terminal.writeln('\x1b[90mPress any key to restart\x1b[0m');
+  sessionExited = true;
+}
+
+/**
+ * Reflect the recording state in the header, and say where files went
+ */
+function showRecording(message: TerminalRecordingMessage): void {
+  const button = document.getElementById('record-btn');
+  const recording = !!message.data?.recording;
+  button?.classList.toggle('recording', recording);
+  button?.setAttribute('title', recording ? `Stop recording (${message.data?.path || 'next session'})` : 'Record session (asciicast)');
+
+  if (!message.success) {
+    terminal?.writeln(`\r\n\x1b[1;31m✗ Could not record: ${message.error || 'unknown error'}\x1b[0m`);
+  } else if (message.data?.saved) {
+    terminal?.writeln(`\r\n\x1b[2m[Recording saved to ${message.data.saved}]\x1b[0m`);
+  }
+}
+
+/**
+ * Fill the launch profile picker from the native host's list
+ */
+function showProfiles(message: TerminalProfilesMessage): void {
+  const select = document.getElementById('profile-select') as HTMLSelectElement | null;
+  if (!select || !message.data) return;
+
+  select.replaceChildren(...message.data.profiles.map((name) => new Option(name, name)));
+  select.classList.toggle('hidden', message.data.profiles.length < 2);
+  selectProfile(message.data.current);
+
+  // Workspaces are shown by folder name, with the full path as tooltip
+  const workspaces = message.data.workspaces || [];
+  const workspaceSelect = document.getElementById('workspace-select') as HTMLSelectElement | null;
+  if (workspaceSelect) {
+    const paths = workspaces.includes(message.data.cwd) ? workspaces : [message.data.cwd, ...workspaces];
+    workspaceSelect.replaceChildren(...paths.map((path) => {
+      const option = new Option(path.split('/').pop() || path, path);
+      option.title = path;
+      return option;
+    }));
+    workspaceSelect.classList.toggle('hidden', workspaces.length === 0);
+    selectWorkspace(message.data.cwd);
+  }
+
+  if (message.data.error) {
+    terminal?.writeln(`\r\n\x1b[1;31m✗ ${message.data.error}\x1b[0m`);
+  }
+}
+
+function selectProfile(profile?: string): void {
+  const select = document.getElementById('profile-select') as HTMLSelectElement | null;
+  if (select && profile) select.value = profile;
+}
+
+function selectWorkspace(cwd?: string): void {
+  const select = document.getElementById('workspace-select') as HTMLSelectElement | null;
+  if (select && cwd) {
+    select.value = cwd;
+    select.title = cwd;
+  }
+}
+
+/**
+ * Show the approval dialog and resolve with the user's decision
+ */
+function showApprovalDialog(request: ApprovalRequestMessage): Promise<ApprovalDecision> {
+  const dialog = document.getElementById('approval-dialog');
+  if (!dialog) {
+    return Promise.resolve({ approved: false, remember: false });
+  }
+
+  const actionLabels: Record<string, string> = {
+    executeScript: 'run JavaScript',
+    modifyDom: 'modify the page',
+    runCommand: 'run a command',
+  };
+
+  const setText = (selector: string, text: string) => {
+    const el = dialog.querySelector(selector);
+    if (el) el.textContent = text;
+  };
+  setText('.approval-action', actionLabels[request.action] || request.action);
+  setText('.approval-origin', request.params.origin);
+  setText('.approval-summary', request.params.summary || '');
+
+  const remember = dialog.querySelector<HTMLInputElement>('#approval-remember');
+  if (remember) remember.checked = false;
+
+  dialog.classList.remove('hidden');
+
+  return new Promise((resolve) => {
+    const allowBtn = document.getElementById('approval-allow');
+    const denyBtn = document.getElementById('approval-deny');
+
+    const finish = (approved: boolean) => {
+      dialog.classList.add('hidden');
+      allowBtn?.removeEventListener('click', onAllow);
+      denyBtn?.removeEventListener('click', onDeny);
+      resolve({ approved, remember: remember?.checked ?? false });
+    };
+    const onAllow = () => finish(true);
+    const onDeny = () => finish(false);
+
+    allowBtn?.addEventListener('click', onAllow);
+    denyBtn?.addEventListener('click', onDeny);
+  });
+}
+
 /**
  * Set up event listeners
  */
 function setupEventListeners(): void {
   // Listen for messages from background script
-  chrome.runtime.onMessage.addListener((message: NativeMessage) => {
+  chrome.runtime.onMessage.addListener((message: NativeMessage, _sender, sendResponse) => {
+    if (message.type === 'browser:approval') {
+      showApprovalDialog(message as ApprovalRequestMessage).then(sendResponse);
+      return true;
+    }
     handleMessage(message);
+    return false;
   });
 
   // Reconnect button
@@ -237,6 +436,51 @@ function setupEventListeners(): void {
     chrome.runtime.sendMessage({ type: 'connection:status', action: 'reconnect' });
   });
 
+  // Paste the page URL and selection (Shift: also the page text) into the prompt
+  document.getElementById('inject-btn')?.addEventListener('click', (event) => {
+    if (!isConnected) return;
+    sendMessage({
+      type: 'terminal:inject',
+      params: event.shiftKey ? { sources: ['url', 'selection', 'text'] } : {}
+    });
+  });
+
+  // Signal the foreground process; programs in raw mode read Ctrl-C as a key
+  document.getElementById('interrupt-btn')?.addEventListener('click', (event) => {
+    if (!isConnected) return;
+    sendMessage({
+      type: 'terminal:signal',
+      params: { signal: event.shiftKey ? 'SIGTSTP' : 'SIGINT' }
+    });
+    terminal?.focus();
+  });
+
+  // Toggle session recording
+  document.getElementById('record-btn')?.addEventListener('click', (event) => {
+    if (!isConnected) return;
+    const recording = (event.currentTarget as HTMLElement).classList.contains('recording');
+    sendMessage({ type: 'terminal:recording', params: { action: recording ? 'stop' : 'start' } });
+  });
+
+  // Switch launch profile (restarts the terminal session)
+  document.getElementById('profile-select')?.addEventListener('change', (event) => {
+    const profile = (event.target as HTMLSelectElement).value;
+    if (isConnected && profile) {
+      terminal?.writeln(`\r\n\x1b[2m[Starting ${profile}...]\x1b[0m`);
+      sendMessage({ type: 'terminal:start', params: { profile } });
+    }
+  });
+
+  // Switch workspace (restarts the terminal session in that directory)
+  document.getElementById('workspace-select')?.addEventListener('change', (event) => {
+    const cwd = (event.target as HTMLSelectElement).value;
+    const profile = (document.getElementById('profile-select') as HTMLSelectElement | null)?.value;
+    if (isConnected && cwd) {
+      terminal?.writeln(`\r\n\x1b[2m[Starting in ${cwd}...]\x1b[0m`);
+      sendMessage({ type: 'terminal:start', params: { profile: profile || undefined, cwd } });
+    }
+  });
+
   // Clear terminal button
   document.getElementById('clear-btn')?.addEventListener('click', () => {
     if (terminal) {
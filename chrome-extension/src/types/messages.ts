@@ -10,11 +10,51 @@ export interface NativeMessage {
   params?: Record<string, unknown>;
   success?: boolean;
   error?: string;
+  topic?: string;
+  dataBase64?: string;
+  paste?: boolean;
+}
+
+// Sent by both sides when the connection opens
+export interface HelloMessage extends NativeMessage {
+  type: 'hello';
+  protocolVersion: number;
+  // Oldest peer protocol this side still talks to
+  minProtocolVersion?: number;
+  // Message types this side handles
+  capabilities: string[];
+  version?: string;
+  // Extension only: per-profile id and browser name, to tell hosts apart
+  instanceId?: string;
+  browser?: string;
+}
+
+// The host couldn't handle a message, or the protocol versions don't match
+export interface ProtocolErrorMessage extends NativeMessage {
+  type: 'protocol:error';
+  error: string;
+  data?: {
+    hostVersion: string;
+    protocolVersion: number;
+    extensionVersion?: string;
+    extensionProtocolVersion?: number;
+  };
+}
+
+// The host pings every few seconds; a missing pong marks the extension
+// unresponsive
+export interface HostPingMessage extends NativeMessage {
+  type: 'host:ping' | 'host:pong';
+  requestId: string;
 }
 
 export interface TerminalInputMessage extends NativeMessage {
   type: 'terminal:input';
-  data: string;
+  data?: string;
+  // Raw bytes (base64), for input that isn't text
+  dataBase64?: string;
+  // Wrapped in bracketed-paste markers if the program enabled them
+  paste?: boolean;
 }
 
 export interface TerminalOutputMessage extends NativeMessage {
@@ -28,6 +68,59 @@ export interface TerminalResizeMessage extends NativeMessage {
   rows: number;
 }
 
+export interface TerminalInjectMessage extends NativeMessage {
+  type: 'terminal:inject';
+  params?: {
+    sources?: Array<'url' | 'selection' | 'text'>;
+    maxChars?: number;
+  };
+}
+
+export interface TerminalSignalMessage extends NativeMessage {
+  type: 'terminal:signal';
+  params: { signal: 'SIGINT' | 'SIGQUIT' | 'SIGTSTP' | 'SIGCONT' | 'SIGTERM' | 'SIGHUP' };
+}
+
+export interface TerminalRecordingMessage extends NativeMessage {
+  type: 'terminal:recording';
+  params?: { action: 'start' | 'stop' | 'status'; input?: boolean };
+  data?: { recording: boolean; path: string; saved?: string };
+}
+
+export interface TerminalStartMessage extends NativeMessage {
+  type: 'terminal:start';
+  params: { profile?: string; cwd?: string };
+}
+
+export interface TerminalProfilesMessage extends NativeMessage {
+  type: 'terminal:profiles';
+  data?: {
+    profiles: string[];
+    defaultProfile: string;
+    current: string;
+    workspaces: string[] | null;
+    cwd: string;
+    error?: string;
+  };
+}
+
+export interface TerminalExitMessage extends NativeMessage {
+  type: 'terminal:exit';
+  data: {
+    profile: string;
+    cwd: string;
+    code: number;
+    signal?: string;
+    uptimeMs: number;
+    restartInMs?: number;
+    reason?: string;
+  };
+}
+
+export interface TerminalRestartMessage extends NativeMessage {
+  type: 'terminal:restart';
+}
+
 export interface BrowserContextRequest extends NativeMessage {
   type: 'browser:request';
   action: string;
@@ -43,6 +136,48 @@ export interface BrowserContextResponse extends NativeMessage {
   error?: string;
 }
 
+export interface ApprovalDetails {
+  origin: string;
+  url: string;
+  title?: string;
+  summary?: string;
+}
+
+export interface ApprovalRequestMessage extends NativeMessage {
+  type: 'browser:approval';
+  action: string;
+  requestId: string;
+  params: ApprovalDetails & Record<string, unknown>;
+}
+
+export interface ApprovalDecision {
+  approved: boolean;
+  remember: boolean;
+}
+
+export type BrowserEventTopic = 'navigation' | 'tab' | 'console' | 'selection' | 'page';
+
+export interface BrowserEventMessage extends NativeMessage {
+  type: 'browser:event';
+  topic: BrowserEventTopic;
+  data: Record<string, unknown>;
+}
+
+export interface PageSelectionMessage {
+  type: 'page:selection';
+  text: string;
+}
+
+// Sent by the content script when the DOM of a watched page changed
+export interface PageChangedMessage {
+  type: 'page:changed';
+}
+
+// Sent to a tab's top frame after a cacheable read, to watch for changes
+export interface PageWatchMessage {
+  type: 'page:watch';
+}
+
 export interface ConnectionStatusMessage {
   type: 'connection:status';
   status: 'connected' | 'disconnected' | 'connecting' | 'error';
@@ -53,8 +188,14 @@ export type ExtensionMessage =
   | TerminalInputMessage
   | TerminalOutputMessage
   | TerminalResizeMessage
+  | TerminalInjectMessage
+  | TerminalStartMessage
+  | TerminalProfilesMessage
   | BrowserContextRequest
   | BrowserContextResponse
+  | ApprovalRequestMessage
+  | PageSelectionMessage
+  | PageChangedMessage
   | ConnectionStatusMessage
   | { type: 'ping' }
   | { type: 'pong'; connectionStatus: string };
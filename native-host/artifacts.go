@@ -0,0 +1,428 @@
+// Artifact Store
+//
+// Manages files produced by tools (screenshots, page dumps, network
+// bodies, any tool result requested with saveTo: "file").
+// Artifacts are content-addressed, indexed in a JSON manifest and kept
+// under a size quota by evicting the least recently used entries. Every MCP
+// server process shares the directory, so the manifest is re-read under a
+// file lock before each use.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// artifactManifestName is the index file inside the artifacts directory
+	artifactManifestName = "manifest.json"
+	// artifactLockName is locked while a process reads or changes the manifest
+	artifactLockName = "manifest.lock"
+)
+
+// ArtifactsConfig holds the artifacts section of config.json
+type ArtifactsConfig struct {
+	// MaxSizeMB is the total size of stored artifacts before the least
+	// recently used are evicted
+	MaxSizeMB int `json:"maxSizeMB"`
+}
+
+// DefaultArtifactsConfig keeps up to 500MB of artifacts
+func DefaultArtifactsConfig() ArtifactsConfig {
+	return ArtifactsConfig{MaxSizeMB: 500}
+}
+
+// Quota returns the size limit in bytes
+func (c ArtifactsConfig) Quota() int64 {
+	if c.MaxSizeMB <= 0 {
+		return int64(DefaultArtifactsConfig().MaxSizeMB) << 20
+	}
+	return int64(c.MaxSizeMB) << 20
+}
+
+// Artifact describes a stored tool output
+type Artifact struct {
+	ID           string    `json:"id"`
+	Path         string    `json:"path"`
+	Tool         string    `json:"tool"`
+	MimeType     string    `json:"mimeType"`
+	Size         int64     `json:"size"`
+	URL          string    `json:"url,omitempty"`
+	Title        string    `json:"title,omitempty"`
+	Truncated    bool      `json:"truncated,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	LastAccessed time.Time `json:"lastAccessed"`
+}
+
+// ArtifactStore manages the artifacts directory and its manifest
+type ArtifactStore struct {
+	dir       string
+	quota     int64
+	artifacts map[string]*Artifact
+	mutex     sync.Mutex
+}
+
+// NewArtifactStore creates a store rooted at dir. Files left out of the
+// manifest (by versions that let processes overwrite each other's
+// manifest) are removed.
+func NewArtifactStore(dir string, quota int64) *ArtifactStore {
+	a := &ArtifactStore{
+		dir:       dir,
+		quota:     quota,
+		artifacts: make(map[string]*Artifact),
+	}
+	if _, err := os.Stat(dir); err == nil {
+		unlock := a.lock()
+		a.removeOrphansLocked()
+		unlock()
+	}
+	return a
+}
+
+// Dir returns the artifacts directory
+func (a *ArtifactStore) Dir() string {
+	return a.dir
+}
+
+// lock takes the mutex and the manifest file lock, then reloads the
+// manifest so entries saved by other processes are seen. Without the file
+// lock (e.g. the directory can't be created) it carries on with the mutex.
+func (a *ArtifactStore) lock() (unlock func()) {
+	a.mutex.Lock()
+
+	var file *os.File
+	err := ensureOutputDir(a.dir)
+	if err == nil {
+		file, err = os.OpenFile(filepath.Join(a.dir, artifactLockName), os.O_CREATE|os.O_RDWR, 0600)
+	}
+	if err == nil {
+		if err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+			file.Close()
+			file = nil
+		}
+	}
+	if err != nil {
+		slog.Warn("[Artifacts] Cannot lock manifest", "error", err)
+	}
+
+	a.load()
+	return func() {
+		if file != nil {
+			// Closing releases the lock
+			file.Close()
+		}
+		a.mutex.Unlock()
+	}
+}
+
+// load replaces the in-memory entries with the manifest on disk. Caller
+// must hold the lock.
+func (a *ArtifactStore) load() {
+	a.artifacts = make(map[string]*Artifact)
+	data, err := os.ReadFile(filepath.Join(a.dir, artifactManifestName))
+	if err != nil {
+		return
+	}
+
+	var list []*Artifact
+	if err := json.Unmarshal(data, &list); err != nil {
+		slog.Warn("[Artifacts] Ignoring corrupt manifest", "error", err)
+		return
+	}
+
+	// Drop entries whose files were removed behind our back
+	for _, artifact := range list {
+		if _, err := os.Stat(artifact.Path); err == nil {
+			a.artifacts[artifact.ID] = artifact
+		}
+	}
+}
+
+// removeOrphansLocked deletes artifact files the manifest doesn't list
+func (a *ArtifactStore) removeOrphansLocked() {
+	entries, err := os.ReadDir(a.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		id := strings.TrimSuffix(name, filepath.Ext(name))
+		if !entry.Type().IsRegular() || !isArtifactID(id) || a.artifacts[id] != nil {
+			continue
+		}
+		os.Remove(filepath.Join(a.dir, name))
+		slog.Info("[Artifacts] Removed orphaned file", "name", name)
+	}
+}
+
+// isArtifactID reports whether id has the form Save gives artifact ids
+func isArtifactID(id string) bool {
+	if len(id) != 16 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// saveManifest writes the manifest atomically. Caller must hold the lock.
+func (a *ArtifactStore) saveManifest() error {
+	data, err := json.MarshalIndent(a.sortedLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(a.dir, artifactManifestName), data, true)
+}
+
+// Save stores content and records it in the manifest. Identical content
+// maps to the same artifact, which only has its metadata refreshed.
+func (a *ArtifactStore) Save(content []byte, ext, mimeType string, meta Artifact) (*Artifact, error) {
+	sum := sha256.Sum256(content)
+	id := hex.EncodeToString(sum[:8])
+	path := filepath.Join(a.dir, id+ext)
+
+	unlock := a.lock()
+	defer unlock()
+
+	if err := ensureOutputDir(a.dir); err != nil {
+		return nil, fmt.Errorf("failed to create artifacts directory: %w", err)
+	}
+
+	now := time.Now()
+	artifact, exists := a.artifacts[id]
+	if !exists {
+		if err := writeFileAtomic(path, content, true); err != nil {
+			return nil, fmt.Errorf("failed to write artifact: %w", err)
+		}
+		artifact = &Artifact{
+			ID:        id,
+			Path:      path,
+			MimeType:  mimeType,
+			Size:      int64(len(content)),
+			CreatedAt: now,
+		}
+		a.artifacts[id] = artifact
+	}
+	artifact.Tool = meta.Tool
+	artifact.URL = meta.URL
+	artifact.Title = meta.Title
+	artifact.Truncated = meta.Truncated
+	artifact.LastAccessed = now
+
+	a.evictLocked(id)
+
+	if err := a.saveManifest(); err != nil {
+		slog.Error("[Artifacts] Failed to write manifest", "error", err)
+	}
+
+	slog.Info("[Artifacts] Saved", "path", artifact.Path, "size", artifact.Size, "tool", artifact.Tool)
+	copied := *artifact
+	return &copied, nil
+}
+
+// evictLocked removes least recently used artifacts until the store fits the
+// quota. The artifact identified by keep is never evicted.
+func (a *ArtifactStore) evictLocked(keep string) {
+	var total int64
+	for _, artifact := range a.artifacts {
+		total += artifact.Size
+	}
+	if total <= a.quota {
+		return
+	}
+
+	lru := make([]*Artifact, 0, len(a.artifacts))
+	for _, artifact := range a.artifacts {
+		lru = append(lru, artifact)
+	}
+	sort.Slice(lru, func(i, j int) bool {
+		return lru[i].LastAccessed.Before(lru[j].LastAccessed)
+	})
+
+	for _, artifact := range lru {
+		if total <= a.quota {
+			break
+		}
+		if artifact.ID == keep {
+			continue
+		}
+		os.Remove(artifact.Path)
+		delete(a.artifacts, artifact.ID)
+		total -= artifact.Size
+		slog.Info("[Artifacts] Evicted", "path", artifact.Path, "size", artifact.Size)
+	}
+}
+
+// Retag updates the metadata of an existing artifact
+func (a *ArtifactStore) Retag(id string, meta Artifact) (*Artifact, error) {
+	unlock := a.lock()
+	defer unlock()
+
+	artifact, ok := a.artifacts[id]
+	if !ok {
+		return nil, fmt.Errorf("artifact not found: %s", id)
+	}
+	artifact.Tool = meta.Tool
+	artifact.URL = meta.URL
+	artifact.Title = meta.Title
+
+	if err := a.saveManifest(); err != nil {
+		slog.Error("[Artifacts] Failed to write manifest", "error", err)
+	}
+
+	copied := *artifact
+	return &copied, nil
+}
+
+// List returns artifacts newest first, optionally filtered by tool
+func (a *ArtifactStore) List(tool string) []Artifact {
+	unlock := a.lock()
+	defer unlock()
+
+	result := []Artifact{}
+	for _, artifact := range a.sortedLocked() {
+		if tool == "" || artifact.Tool == tool {
+			result = append(result, *artifact)
+		}
+	}
+	return result
+}
+
+func (a *ArtifactStore) sortedLocked() []*Artifact {
+	list := make([]*Artifact, 0, len(a.artifacts))
+	for _, artifact := range a.artifacts {
+		list = append(list, artifact)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Delete removes an artifact and its file
+func (a *ArtifactStore) Delete(id string) error {
+	unlock := a.lock()
+	defer unlock()
+
+	artifact, ok := a.artifacts[id]
+	if !ok {
+		return fmt.Errorf("artifact not found: %s", id)
+	}
+
+	if err := os.Remove(artifact.Path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete artifact: %w", err)
+	}
+	delete(a.artifacts, id)
+
+	return a.saveManifest()
+}
+
+// TotalSize returns the combined size of all artifacts
+func (a *ArtifactStore) TotalSize() int64 {
+	unlock := a.lock()
+	defer unlock()
+
+	var total int64
+	for _, artifact := range a.artifacts {
+		total += artifact.Size
+	}
+	return total
+}
+
+// saveResultAsArtifact stores the content of a successful tool response as
+// artifacts and returns their metadata in place of the content
+func (s *MCPServer) saveResultAsArtifact(id interface{}, tool string, response *JSONRPCResponse) *JSONRPCResponse {
+	result, _ := response.Result.(map[string]interface{})
+	content, _ := result["content"].([]map[string]interface{})
+
+	meta := Artifact{Tool: tool}
+	saved := []*Artifact{}
+	for _, item := range content {
+		var data []byte
+		var ext, mimeType string
+
+		switch item["type"] {
+		case "image":
+			encoded, _ := item["data"].(string)
+			decoded, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return s.errorResponse(id, -32000, fmt.Sprintf("Failed to decode image: %v", err))
+			}
+			data = decoded
+			mimeType, _ = item["mimeType"].(string)
+			ext = extensionForMimeType(mimeType)
+		case "text":
+			text, _ := item["text"].(string)
+			data = []byte(text)
+			ext, mimeType = ".txt", "text/plain"
+			if json.Valid(data) {
+				ext, mimeType = ".json", "application/json"
+				var page struct {
+					URL   string `json:"url"`
+					Title string `json:"title"`
+				}
+				if json.Unmarshal(data, &page) == nil && meta.URL == "" {
+					meta.URL, meta.Title = page.URL, page.Title
+				}
+			}
+		default:
+			continue
+		}
+
+		artifact, err := s.artifacts.Save(data, ext, mimeType, meta)
+		if err != nil {
+			return s.errorResponse(id, -32000, err.Error())
+		}
+		saved = append(saved, artifact)
+	}
+
+	// Results without page info (e.g. screenshots) are tagged with the active tab
+	if meta.URL == "" && len(saved) > 0 {
+		if socketResp, errResp := s.browserRequest(id, "getUrl", nil); errResp == nil {
+			if page, ok := socketResp.Data.(map[string]interface{}); ok {
+				meta.URL, _ = page["url"].(string)
+				meta.Title, _ = page["title"].(string)
+				for i, artifact := range saved {
+					if updated, err := s.artifacts.Retag(artifact.ID, meta); err == nil {
+						saved[i] = updated
+					}
+				}
+			}
+		}
+	}
+
+	return s.textResponse(id, map[string]interface{}{
+		"artifacts": saved,
+		"message":   fmt.Sprintf("Saved %d artifact(s) to %s. Use your file reading tools to analyze them.", len(saved), s.artifacts.Dir()),
+	})
+}
+
+func extensionForMimeType(mimeType string) string {
+	switch mimeType {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	case "application/json":
+		return ".json"
+	case "text/plain":
+		return ".txt"
+	default:
+		return ".bin"
+	}
+}
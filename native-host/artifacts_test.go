@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArtifactStoreSharedManifest(t *testing.T) {
+	dir := t.TempDir()
+	// Two MCP server processes on the same directory
+	first := NewArtifactStore(dir, 1<<20)
+	second := NewArtifactStore(dir, 1<<20)
+
+	a, err := first.Save([]byte("from first"), ".txt", "text/plain", Artifact{Tool: "one"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := second.Save([]byte("from second"), ".txt", "text/plain", Artifact{Tool: "two"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, store := range map[string]*ArtifactStore{"first": first, "second": second} {
+		if got := len(store.List("")); got != 2 {
+			t.Errorf("%s store lists %d artifacts, want 2", name, got)
+		}
+	}
+
+	if err := first.Delete(b.ID); err != nil {
+		t.Fatalf("deleting the other process's artifact: %v", err)
+	}
+	if _, err := second.Retag(b.ID, Artifact{Tool: "two"}); err == nil {
+		t.Error("retagged an artifact another process deleted")
+	}
+	if list := second.List(""); len(list) != 1 || list[0].ID != a.ID {
+		t.Errorf("second store lists %+v, want only %s", list, a.ID)
+	}
+}
+
+func TestArtifactStoreQuotaAcrossProcesses(t *testing.T) {
+	dir := t.TempDir()
+	first := NewArtifactStore(dir, 10)
+	second := NewArtifactStore(dir, 10)
+
+	old, _ := first.Save([]byte("123456"), ".txt", "text/plain", Artifact{})
+	recent, _ := second.Save([]byte("abcdef"), ".txt", "text/plain", Artifact{})
+
+	if _, err := os.Stat(old.Path); !os.IsNotExist(err) {
+		t.Error("the least recently used artifact was not evicted")
+	}
+	if list := first.List(""); len(list) != 1 || list[0].ID != recent.ID {
+		t.Errorf("store lists %+v, want only %s", list, recent.ID)
+	}
+	if size := first.TotalSize(); size != 6 {
+		t.Errorf("total size = %d, want 6", size)
+	}
+}
+
+func TestArtifactStoreRemovesOrphans(t *testing.T) {
+	dir := t.TempDir()
+	store := NewArtifactStore(dir, 1<<20)
+	kept, _ := store.Save([]byte("kept"), ".txt", "text/plain", Artifact{})
+
+	orphan := filepath.Join(dir, "0123456789abcdef.png")
+	other := filepath.Join(dir, "notes.txt")
+	os.WriteFile(orphan, []byte("lost"), 0644)
+	os.WriteFile(other, []byte("mine"), 0644)
+
+	NewArtifactStore(dir, 1<<20)
+
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Error("orphaned artifact file was kept")
+	}
+	for _, path := range []string{kept.Path, other} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s was removed", filepath.Base(path))
+		}
+	}
+}
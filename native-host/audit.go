@@ -0,0 +1,203 @@
+// Audit Log
+//
+// Structured, append-only record (JSONL) of every action requested by
+// MCP clients through the socket server: who asked, what was asked
+// (with sensitive parameters redacted), which page it targeted, how it
+// ended and how long it took.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// AuditMaxSize is the size at which the audit log rotates
+	AuditMaxSize = 10 * 1024 * 1024 // 10MB
+	// AuditMaxBackups is the number of rotated audit files kept
+	AuditMaxBackups = 5
+	// auditMaxParamLength truncates long parameter strings
+	auditMaxParamLength = 200
+)
+
+// Audit outcomes
+const (
+	AuditSuccess = "success"
+	AuditError   = "error"
+	AuditDenied  = "denied"
+)
+
+// sensitiveParams are never written to the audit log, only their length
+var sensitiveParams = map[string]bool{
+	"script":   true,
+	"value":    true,
+	"data":     true,
+	"password": true,
+	"token":    true,
+	"env":      true,
+}
+
+// AuditEntry is one line of the audit log
+type AuditEntry struct {
+	Timestamp  time.Time              `json:"timestamp"`
+	Client     string                 `json:"client"`
+	RequestId  string                 `json:"requestId"`
+	Action     string                 `json:"action"`
+	Params     map[string]interface{} `json:"params,omitempty"`
+	TargetURL  string                 `json:"targetUrl,omitempty"`
+	Outcome    string                 `json:"outcome"`
+	Error      string                 `json:"error,omitempty"`
+	Cached     bool                   `json:"cached,omitempty"`
+	DurationMs int64                  `json:"durationMs"`
+}
+
+// AuditLog writes audit entries to a rotating JSONL file
+type AuditLog struct {
+	file *RotatingFile
+}
+
+// AuditLogPath returns the location of the audit log
+func AuditLogPath() string {
+	return filepath.Join(GetInstallDir(), "audit", "audit.jsonl")
+}
+
+// NewAuditLog opens the audit log at path
+func NewAuditLog(path string) (*AuditLog, error) {
+	file, err := NewRotatingFile(path, AuditMaxSize, AuditMaxBackups)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{file: file}, nil
+}
+
+// Record appends an entry. Failures are logged, never returned, so auditing
+// can't break request handling.
+func (a *AuditLog) Record(entry AuditEntry) {
+	if a == nil {
+		return
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		slog.Error("[Audit] Failed to marshal entry", "error", err)
+		return
+	}
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		slog.Error("[Audit] Failed to write entry", "error", err)
+	}
+}
+
+// History returns the most recent entries (newest first), optionally
+// filtered by action and start time
+func (a *AuditLog) History(action string, since time.Time, limit int) ([]AuditEntry, error) {
+	if a == nil {
+		return nil, fmt.Errorf("audit log is not available")
+	}
+
+	result := []AuditEntry{}
+	for _, path := range a.file.Files() {
+		entries, err := readAuditFile(path)
+		if err != nil {
+			return nil, err
+		}
+		// Files hold entries oldest first; walk backwards for newest first
+		for i := len(entries) - 1; i >= 0; i-- {
+			entry := entries[i]
+			if action != "" && entry.Action != action {
+				continue
+			}
+			if !since.IsZero() && entry.Timestamp.Before(since) {
+				return result, nil
+			}
+			result = append(result, entry)
+			if limit > 0 && len(result) >= limit {
+				return result, nil
+			}
+		}
+	}
+	return result, nil
+}
+
+func readAuditFile(path string) ([]AuditEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// Close closes the audit log
+func (a *AuditLog) Close() {
+	if a != nil {
+		a.file.Close()
+	}
+}
+
+// redactParams copies params, hiding sensitive values and truncating long strings
+func redactParams(params interface{}) map[string]interface{} {
+	p, ok := params.(map[string]interface{})
+	if !ok || len(p) == 0 {
+		return nil
+	}
+
+	redacted := make(map[string]interface{}, len(p))
+	for key, value := range p {
+		str, isString := value.(string)
+		switch {
+		case sensitiveParams[key] && isString:
+			redacted[key] = fmt.Sprintf("[redacted %d chars]", len(str))
+		case sensitiveParams[key]:
+			redacted[key] = "[redacted]"
+		case isString && len(str) > auditMaxParamLength:
+			redacted[key] = str[:auditMaxParamLength] + "..."
+		default:
+			redacted[key] = value
+		}
+	}
+	return redacted
+}
+
+// handleActionHistory serves the getActionHistory socket action
+func (a *AuditLog) handleActionHistory(params interface{}) (interface{}, error) {
+	p, _ := params.(map[string]interface{})
+
+	action, _ := p["action"].(string)
+	limit := 50
+	if l, ok := p["limit"].(float64); ok && l > 0 {
+		limit = int(l)
+	}
+	var since time.Time
+	if minutes, ok := p["sinceMinutes"].(float64); ok && minutes > 0 {
+		since = time.Now().Add(-time.Duration(minutes * float64(time.Minute)))
+	}
+
+	entries, err := a.History(action, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"entries": entries,
+		"count":   len(entries),
+		"logFile": AuditLogPath(),
+	}, nil
+}
@@ -8,7 +8,7 @@ package main
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"sync"
 	"time"
@@ -18,27 +18,315 @@ import (
 
 const RequestTimeout = 30 * time.Second
 
-// BrowserBridge manages request/response correlation
+// ApprovalTimeout bounds how long the user has to answer an approval prompt
+const ApprovalTimeout = 60 * time.Second
+
+// The host pings the extension every HeartbeatInterval. Once nothing has
+// arrived from Chrome for HeartbeatTimeout (e.g. its service worker was
+// suspended), requests are queued for the grace window and then fail,
+// instead of waiting for RequestTimeout.
+const (
+	HeartbeatInterval = 5 * time.Second
+	HeartbeatTimeout  = 15 * time.Second
+)
+
+// BridgeConfig holds the bridge section of config.json
+type BridgeConfig struct {
+	// QueueGraceMs is how long a request waits for an unresponsive
+	// extension to come back before failing (0: fail at once)
+	QueueGraceMs int `json:"queueGraceMs"`
+	// QueueSize bounds the requests waiting; more are rejected
+	QueueSize int `json:"queueSize"`
+}
+
+// DefaultBridgeConfig holds requests for up to 10 seconds
+func DefaultBridgeConfig() BridgeConfig {
+	return BridgeConfig{
+		QueueGraceMs: 10000,
+		QueueSize:    64,
+	}
+}
+
+// QueueGrace returns QueueGraceMs as a duration
+func (c BridgeConfig) QueueGrace() time.Duration {
+	return time.Duration(c.QueueGraceMs) * time.Millisecond
+}
+
+// queuedRequest is a request waiting for the extension to answer again.
+// sent receives the result of writing it to Chrome.
+type queuedRequest struct {
+	req      BrowserRequest
+	deadline time.Time
+	sent     chan error
+}
+
+// BrowserBridge manages request/response correlation and fans out the
+// events Chrome pushes without being asked
 type BrowserBridge struct {
-	pending map[string]chan *Message
-	mutex   sync.RWMutex
+	pending map[string]chan *BrowserResponse
+	events  *EventBroker
+	config  BridgeConfig
+	cache   *ResponseCache
+	// Requests held while the extension isn't answering, sent in order by
+	// flushQueue once it is; closed is set when Chrome disconnects
+	queue    []*queuedRequest
+	flushing bool
+	closed   bool
+	// extension is the hello Chrome sent, nil until it arrives
+	extension *HelloMessage
+	// Liveness: when anything last arrived from Chrome, and the last
+	// host:ping and its round trip
+	lastSeen  time.Time
+	pingId    string
+	pingSent  time.Time
+	pingRTT   time.Duration
+	pingCount int
+	mutex     sync.RWMutex
 }
 
 // NewBrowserBridge creates a new browser bridge
-func NewBrowserBridge() *BrowserBridge {
+func NewBrowserBridge(config BridgeConfig, cache CacheConfig) *BrowserBridge {
 	return &BrowserBridge{
-		pending: make(map[string]chan *Message),
+		pending:  make(map[string]chan *BrowserResponse),
+		events:   NewEventBroker(),
+		config:   config,
+		cache:    NewResponseCache(cache),
+		lastSeen: time.Now(),
+	}
+}
+
+// Cache returns the response cache for read-only actions
+func (b *BrowserBridge) Cache() *ResponseCache {
+	return b.cache
+}
+
+// Events returns the broker for events published by Chrome
+func (b *BrowserBridge) Events() *EventBroker {
+	return b.events
+}
+
+// SetExtension records the extension's hello
+func (b *BrowserBridge) SetExtension(hello *HelloMessage) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.extension = hello
+}
+
+// Extension returns the extension's hello, or nil if it hasn't sent one
+func (b *BrowserBridge) Extension() *HelloMessage {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.extension
+}
+
+// MarkAlive records that a message arrived from Chrome, and sends the
+// queued requests if there are any
+func (b *BrowserBridge) MarkAlive() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.lastSeen = time.Now()
+	if len(b.queue) > 0 && !b.flushing {
+		b.flushing = true
+		go b.flushQueue()
 	}
 }
 
+// HandlePong records the round trip of a host:ping
+func (b *BrowserBridge) HandlePong(msg *HostPongMessage) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if msg.RequestId == b.pingId {
+		b.pingRTT = time.Since(b.pingSent)
+	}
+}
+
+// Heartbeat pings the extension every HeartbeatInterval until stop is
+// closed. Extensions that don't announce host:ping aren't pinged and are
+// never reported unresponsive.
+func (b *BrowserBridge) Heartbeat(stop <-chan struct{}) {
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if !b.heartbeatEnabled() {
+			continue
+		}
+
+		b.mutex.Lock()
+		b.pingCount++
+		b.pingId = fmt.Sprintf("ping-%d", b.pingCount)
+		b.pingSent = time.Now()
+		ping := Message{Type: "host:ping", RequestId: b.pingId}
+		b.mutex.Unlock()
+
+		if err := WriteNativeMessage(os.Stdout, ping); err != nil {
+			slog.Error("[Bridge] Failed to write ping", "error", err)
+		}
+	}
+}
+
+func (b *BrowserBridge) heartbeatEnabled() bool {
+	ext := b.Extension()
+	return ext != nil && ext.Supports("host:ping")
+}
+
+// checkAlive returns an error when the extension has stopped answering pings
+func (b *BrowserBridge) checkAlive() error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.aliveLocked()
+}
+
+// aliveLocked is checkAlive for callers holding the mutex
+func (b *BrowserBridge) aliveLocked() error {
+	if b.extension == nil || !b.extension.Supports("host:ping") {
+		return nil
+	}
+	silent := time.Since(b.lastSeen)
+	if silent > HeartbeatTimeout {
+		return fmt.Errorf("Chrome extension not responding (nothing received for %v). Its service worker may be suspended; open the side panel to wake it", silent.Round(time.Second))
+	}
+	return nil
+}
+
+// Liveness reports whether the extension is answering, for the status API
+func (b *BrowserBridge) Liveness() map[string]interface{} {
+	heartbeat := b.heartbeatEnabled()
+	alive := b.checkAlive() == nil
+
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	liveness := map[string]interface{}{
+		"alive":          alive,
+		"heartbeat":      heartbeat,
+		"lastSeenMs":     time.Since(b.lastSeen).Milliseconds(),
+		"queuedRequests": len(b.queue),
+	}
+	if b.pingRTT > 0 {
+		liveness["pingRttMs"] = float64(b.pingRTT.Microseconds()) / 1000
+	}
+	return liveness
+}
+
+// HandleEvent publishes a browser:event message from Chrome to subscribers
+func (b *BrowserBridge) HandleEvent(msg *BrowserEventMessage) {
+	if msg.Topic == "" {
+		slog.Warn("[Bridge] Event without topic")
+		return
+	}
+	slog.Debug("[Bridge] Event", "topic", msg.Topic)
+	// Before subscribers see it, so nobody reads the old page from the cache
+	b.cache.HandleEvent(msg.Topic, msg.Data)
+	b.events.Publish(BrowserEvent{
+		Type:      "browser:event",
+		Topic:     msg.Topic,
+		Data:      msg.Data,
+		Timestamp: time.Now(),
+	})
+}
+
 // Request sends a request to Chrome and waits for response
-func (b *BrowserBridge) Request(action string, params interface{}, requestId string) (*Message, error) {
+func (b *BrowserBridge) Request(action string, params interface{}, requestId string) (*BrowserResponse, error) {
 	if requestId == "" {
 		requestId = uuid.New().String()
 	}
 
+	req := BrowserRequest{
+		Type:      "browser:request",
+		Action:    action,
+		Params:    params,
+		RequestId: requestId,
+	}
+
+	slog.Info("[Bridge] Sending request to Chrome", "action", action, "requestId", requestId)
+	return b.roundTrip(req, requestId, RequestTimeout)
+}
+
+// RequestCached is Request for MCP clients: read-only actions on a page
+// that hasn't changed are answered from the cache unless params has
+// noCache set. Reports whether the response came from the cache.
+func (b *BrowserBridge) RequestCached(action string, params interface{}, requestId string) (*BrowserResponse, bool, error) {
+	if !b.cache.Cacheable(action) {
+		resp, err := b.Request(action, params, requestId)
+		b.cache.AfterAction(action, pinnedTarget(params).TabId)
+		return resp, false, err
+	}
+
+	// Key on the tab the read will run on: the one the policy pinned, else
+	// the active tab, which the request is then pinned to
+	target := pinnedTarget(params)
+	if target.TabId == 0 {
+		tab, err := b.ActiveTab()
+		if err != nil {
+			resp, err := b.Request(action, params, requestId)
+			return resp, false, err
+		}
+		target = tab
+		params = target.Pin(params)
+	}
+
+	key, generation := b.cache.Key(action, params, target)
+	p, _ := params.(map[string]interface{})
+	if noCache, _ := p["noCache"].(bool); key != "" && !noCache {
+		if resp := b.cache.Get(key); resp != nil {
+			slog.Info("[Bridge] Answered from cache", "action", action, "requestId", requestId)
+			return resp, true, nil
+		}
+	}
+
+	resp, err := b.Request(action, params, requestId)
+	if err == nil {
+		b.cache.Put(key, generation, target.TabId, action, resp)
+	}
+	return resp, false, err
+}
+
+// ActiveTab asks Chrome for the active tab of the focused window
+func (b *BrowserBridge) ActiveTab() (PolicyTarget, error) {
+	resp, err := b.Request("getUrl", nil, "")
+	if err != nil {
+		return PolicyTarget{}, err
+	}
+	if !resp.Success {
+		return PolicyTarget{}, fmt.Errorf("%s", resp.Error)
+	}
+	data, _ := resp.Data.(map[string]interface{})
+	var target PolicyTarget
+	target.URL, _ = data["url"].(string)
+	target.Title, _ = data["title"].(string)
+	if id, ok := data["id"].(float64); ok {
+		target.TabId = int(id)
+	}
+	return target, nil
+}
+
+// RequestApproval asks the user (via the side panel) to approve an action
+func (b *BrowserBridge) RequestApproval(action string, details interface{}) (*BrowserResponse, error) {
+	requestId := uuid.New().String()
+
+	req := BrowserRequest{
+		Type:      "browser:approval",
+		Action:    action,
+		Params:    details,
+		RequestId: requestId,
+	}
+
+	slog.Info("[Bridge] Requesting approval", "action", action, "requestId", requestId)
+	return b.roundTrip(req, requestId, ApprovalTimeout)
+}
+
+// roundTrip sends a message to Chrome and waits for the reply with the same requestId
+func (b *BrowserBridge) roundTrip(req BrowserRequest, requestId string, timeout time.Duration) (*BrowserResponse, error) {
+	// An extension that announced its capabilities won't answer anything else
+	if ext := b.Extension(); ext != nil && !ext.Supports(req.Type) {
+		return nil, fmt.Errorf("the Chrome extension (%s) does not support %s. Update and reload the extension", ext.Version, req.Type)
+	}
 	// Create response channel
-	respChan := make(chan *Message, 1)
+	respChan := make(chan *BrowserResponse, 1)
 	b.mutex.Lock()
 	b.pending[requestId] = respChan
 	b.mutex.Unlock()
@@ -50,47 +338,176 @@ func (b *BrowserBridge) Request(action string, params interface{}, requestId str
 		b.mutex.Unlock()
 	}()
 
-	// Send request to Chrome via Native Messaging
-	req := Message{
-		Type:      "browser:request",
-		Action:    action,
-		Params:    params,
-		RequestId: requestId,
+	// Send request to Chrome via Native Messaging, after the queued ones
+	if err := b.send(req); err != nil {
+		return nil, err
 	}
 
-	log.Printf("[Bridge] Sending request to Chrome: %s (%s)", action, requestId)
-	if err := WriteNativeMessage(os.Stdout, req); err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+	// Wait for response with timeout, giving up early if the extension
+	// stops answering pings meanwhile
+	deadline := time.After(timeout)
+	liveness := time.NewTicker(HeartbeatInterval)
+	defer liveness.Stop()
+	for {
+		select {
+		case resp := <-respChan:
+			slog.Debug("[Bridge] Received response", "requestId", requestId)
+			return resp, nil
+		case <-liveness.C:
+			if err := b.checkAlive(); err != nil {
+				slog.Warn("[Bridge] Extension stopped responding", "action", req.Action, "requestId", requestId)
+				return nil, err
+			}
+		case <-deadline:
+			slog.Warn("[Bridge] Request timed out", "action", req.Action, "requestId", requestId, "timeout", timeout)
+			hostMetrics.RecordTimeout(req.Action)
+			b.events.Publish(BrowserEvent{
+				Type:  "browser:event",
+				Topic: EventHost,
+				Data: map[string]interface{}{
+					"level":     "warning",
+					"message":   fmt.Sprintf("Chrome did not answer %s within %v", req.Action, timeout),
+					"action":    req.Action,
+					"requestId": requestId,
+				},
+				Timestamp: time.Now(),
+			})
+			return nil, fmt.Errorf("request timeout after %v", timeout)
+		}
+	}
+}
+
+// send writes a request to Chrome, or queues it while the extension isn't
+// answering. Queued requests are sent in the order they arrived; each
+// fails on its own once the grace window since it was queued has passed.
+func (b *BrowserBridge) send(req BrowserRequest) error {
+	b.mutex.Lock()
+	if b.closed {
+		b.mutex.Unlock()
+		return fmt.Errorf("the Chrome extension disconnected")
 	}
+	stale := b.aliveLocked()
+	if stale == nil && len(b.queue) == 0 {
+		b.mutex.Unlock()
+		return b.write(req)
+	}
+	grace := b.config.QueueGrace()
+	if stale != nil && (grace <= 0 || b.config.QueueSize <= 0) {
+		b.mutex.Unlock()
+		slog.Warn("[Bridge] Extension not responding, failing request", "action", req.Action, "requestId", req.RequestId)
+		return stale
+	}
+	if len(b.queue) >= b.config.QueueSize {
+		b.mutex.Unlock()
+		slog.Warn("[Bridge] Request queue full, rejecting", "action", req.Action, "requestId", req.RequestId, "queued", len(b.queue))
+		return fmt.Errorf("request queue full: %d requests are already waiting for the Chrome extension", b.config.QueueSize)
+	}
+	queued := &queuedRequest{req: req, deadline: time.Now().Add(grace), sent: make(chan error, 1)}
+	b.queue = append(b.queue, queued)
+	if stale == nil && !b.flushing {
+		// The extension came back while others were queued
+		b.flushing = true
+		go b.flushQueue()
+	}
+	position := len(b.queue)
+	b.mutex.Unlock()
+	slog.Info("[Bridge] Extension not responding, queueing request", "action", req.Action, "requestId", req.RequestId, "position", position, "grace", grace)
 
-	// Wait for response with timeout
+	timer := time.NewTimer(time.Until(queued.deadline))
+	defer timer.Stop()
 	select {
-	case resp := <-respChan:
-		log.Printf("[Bridge] Received response for: %s", requestId)
-		return resp, nil
-	case <-time.After(RequestTimeout):
-		return nil, fmt.Errorf("request timeout after %v", RequestTimeout)
+	case err := <-queued.sent:
+		return err
+	case <-timer.C:
+	}
+
+	// Unless flushQueue took it meanwhile, give up
+	if !b.dequeue(queued) {
+		return <-queued.sent
+	}
+	slog.Warn("[Bridge] Extension did not come back, failing queued request", "action", req.Action, "requestId", req.RequestId)
+	if err := b.checkAlive(); err != nil {
+		return err
 	}
+	return fmt.Errorf("Chrome extension not responding: request was queued for %v", grace)
+}
+
+// dequeue removes a queued request, reporting whether it was still queued
+func (b *BrowserBridge) dequeue(queued *queuedRequest) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for i, q := range b.queue {
+		if q == queued {
+			b.queue = append(b.queue[:i], b.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// flushQueue sends the queued requests in order, until the queue is empty
+// or the extension stops answering again
+func (b *BrowserBridge) flushQueue() {
+	for {
+		b.mutex.Lock()
+		if len(b.queue) == 0 || b.closed || b.aliveLocked() != nil {
+			b.flushing = false
+			b.mutex.Unlock()
+			return
+		}
+		queued := b.queue[0]
+		b.queue = b.queue[1:]
+		b.mutex.Unlock()
+
+		slog.Info("[Bridge] Sending queued request", "action", queued.req.Action, "requestId", queued.req.RequestId)
+		queued.sent <- b.write(queued.req)
+	}
+}
+
+// Close rejects the queued requests once Chrome has disconnected
+func (b *BrowserBridge) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.closed = true
+	for _, queued := range b.queue {
+		queued.sent <- fmt.Errorf("the Chrome extension disconnected")
+	}
+	b.queue = nil
+}
+
+func (b *BrowserBridge) write(req BrowserRequest) error {
+	if err := WriteNativeMessage(os.Stdout, req); err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	return nil
 }
 
 // HandleResponse routes a response from Chrome to the waiting request
-func (b *BrowserBridge) HandleResponse(requestId string, msg Message) {
+func (b *BrowserBridge) HandleResponse(msg *BrowserResponse) {
+	requestId := msg.RequestId
 	b.mutex.RLock()
 	respChan, ok := b.pending[requestId]
 	b.mutex.RUnlock()
 
 	if ok {
 		select {
-		case respChan <- &msg:
-			log.Printf("[Bridge] Routed response for: %s", requestId)
+		case respChan <- msg:
+			slog.Debug("[Bridge] Routed response", "requestId", requestId)
 		default:
-			log.Printf("[Bridge] Response channel full for: %s", requestId)
+			slog.Warn("[Bridge] Response channel full", "requestId", requestId)
 		}
 	} else {
-		log.Printf("[Bridge] No pending request for: %s", requestId)
+		slog.Warn("[Bridge] No pending request", "requestId", requestId)
 	}
 }
 
+// QueueLength returns the number of requests waiting for the extension
+func (b *BrowserBridge) QueueLength() int {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return len(b.queue)
+}
+
 // GetPendingCount returns the number of pending requests
 func (b *BrowserBridge) GetPendingCount() int {
 	b.mutex.RLock()
@@ -0,0 +1,367 @@
+// Command Execution
+//
+// Serves the runCommand socket action: runs a command outside the side
+// panel terminal (through pipes, or a private PTY for programs that need a
+// terminal) and returns its output and exit code. Off unless
+// commands.enabled is set in config.json, since it lets any MCP client run
+// arbitrary programs as the user.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+// CommandsConfig holds the commands section of config.json
+type CommandsConfig struct {
+	// Enabled allows MCP clients to run commands with run_command
+	Enabled bool `json:"enabled"`
+	// TimeoutSeconds applies when the request doesn't give one;
+	// MaxTimeoutSeconds caps what it may ask for
+	TimeoutSeconds    int `json:"timeoutSeconds"`
+	MaxTimeoutSeconds int `json:"maxTimeoutSeconds"`
+	// MaxOutputBytes is kept per stream; the rest is dropped
+	MaxOutputBytes int `json:"maxOutputBytes"`
+}
+
+// DefaultCommandsConfig keeps command execution disabled
+func DefaultCommandsConfig() CommandsConfig {
+	return CommandsConfig{
+		TimeoutSeconds:    120,
+		MaxTimeoutSeconds: 1800,
+		MaxOutputBytes:    1024 * 1024,
+	}
+}
+
+// commandKillGrace is how long a timed-out command gets after SIGTERM, and
+// how long it may take to go after SIGKILL before it is abandoned
+const commandKillGrace = 2 * time.Second
+
+// commandOutputDelay is how long output is still read after the command
+// exits. Background children (e.g. "server &") may keep the output open
+// indefinitely; the result doesn't wait for them.
+const commandOutputDelay = 500 * time.Millisecond
+
+// CommandRunner runs commands for MCP clients
+type CommandRunner struct {
+	config CommandsConfig
+	// defaultDir returns the working directory when none is requested
+	defaultDir func() string
+}
+
+// NewCommandRunner creates a runner. defaultDir supplies the working
+// directory for requests without one (the terminal's, so commands run in
+// the same project).
+func NewCommandRunner(config CommandsConfig, defaultDir func() string) *CommandRunner {
+	return &CommandRunner{config: config, defaultDir: defaultDir}
+}
+
+// CommandResult is what runCommand returns
+type CommandResult struct {
+	Command    string `json:"command"`
+	Cwd        string `json:"cwd"`
+	Mode       string `json:"mode"`
+	ExitCode   int    `json:"exitCode"`
+	Signal     string `json:"signal,omitempty"`
+	TimedOut   bool   `json:"timedOut,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+	Output     string `json:"output,omitempty"`
+	Stdout     string `json:"stdout,omitempty"`
+	Stderr     string `json:"stderr,omitempty"`
+	Truncated  bool   `json:"truncated,omitempty"`
+}
+
+// handleRunCommand serves the runCommand socket action. params:
+//   - command: shell command line, run with $SHELL -c (or /bin/sh)
+//   - args: if given, command is the program and args its arguments (no shell)
+//   - cwd, env (object), timeoutSeconds
+//   - mode: "pipe" (default) or "pty"
+//   - output: "combined" (default) or "separate" (stdout and stderr apart; pipe mode only)
+func (c *CommandRunner) handleRunCommand(params interface{}) (interface{}, error) {
+	if !c.config.Enabled {
+		return nil, fmt.Errorf("run_command is disabled. Set \"commands\": {\"enabled\": true} in %s to allow it", ConfigPath())
+	}
+
+	p, _ := params.(map[string]interface{})
+	command, _ := p["command"].(string)
+	if strings.TrimSpace(command) == "" {
+		return nil, fmt.Errorf("command is required")
+	}
+
+	mode, _ := p["mode"].(string)
+	if mode == "" {
+		mode = "pipe"
+	}
+	if mode != "pipe" && mode != "pty" {
+		return nil, fmt.Errorf("mode must be pipe or pty")
+	}
+	output, _ := p["output"].(string)
+	if output == "" {
+		output = "combined"
+	}
+	if output != "combined" && output != "separate" {
+		return nil, fmt.Errorf("output must be combined or separate")
+	}
+	if output == "separate" && mode == "pty" {
+		return nil, fmt.Errorf("a PTY has a single output stream; use output: combined with mode: pty")
+	}
+
+	timeout := time.Duration(c.config.TimeoutSeconds) * time.Second
+	if t, ok := p["timeoutSeconds"].(float64); ok && t > 0 {
+		timeout = time.Duration(t * float64(time.Second))
+	}
+	if max := time.Duration(c.config.MaxTimeoutSeconds) * time.Second; max > 0 && timeout > max {
+		timeout = max
+	}
+
+	requested, _ := p["cwd"].(string)
+	if requested == "" && c.defaultDir != nil {
+		requested = c.defaultDir()
+	}
+	if requested == "" {
+		requested, _ = os.UserHomeDir()
+	}
+	dir, err := validateWorkspace(requested)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd, err := buildCommand(command, p["args"])
+	if err != nil {
+		return nil, err
+	}
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "PATH="+getEnhancedPath())
+	if env, ok := p["env"].(map[string]interface{}); ok {
+		for key, value := range env {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%v", key, value))
+		}
+	}
+
+	result := &CommandResult{Command: command, Cwd: dir, Mode: mode}
+	slog.Info("[Command] Running", "command", command, "cwd", dir, "mode", mode, "timeout", timeout)
+
+	if mode == "pty" {
+		err = c.runPTY(cmd, timeout, result)
+	} else {
+		err = c.runPipes(cmd, timeout, output == "separate", result)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("[Command] Finished", "command", command, "exitCode", result.ExitCode, "timedOut", result.TimedOut, "durationMs", result.DurationMs)
+	return result, nil
+}
+
+// buildCommand runs command through the shell, or directly when args are given
+func buildCommand(command string, rawArgs interface{}) (*exec.Cmd, error) {
+	list, ok := rawArgs.([]interface{})
+	if !ok {
+		shell := os.Getenv("SHELL")
+		if shell == "" {
+			shell = "/bin/sh"
+		}
+		return exec.Command(shell, "-c", command), nil
+	}
+
+	args := make([]string, len(list))
+	for i, arg := range list {
+		s, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("args must be strings")
+		}
+		args[i] = s
+	}
+	path, err := lookPath(command)
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command(path, args...), nil
+}
+
+// runPipes runs cmd with stdin closed and stdout/stderr captured
+func (c *CommandRunner) runPipes(cmd *exec.Cmd, timeout time.Duration, separate bool, result *CommandResult) error {
+	stdout := newCappedBuffer(c.config.MaxOutputBytes)
+	stderr := stdout
+	if separate {
+		stderr = newCappedBuffer(c.config.MaxOutputBytes)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// Wait also waits for the goroutines copying the output
+	cmd.WaitDelay = commandOutputDelay
+	// Own process group, so a timeout also stops what the command spawned
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start command: %w", err)
+	}
+	timedOut, exited := waitWithTimeout(cmd, timeout)
+	result.TimedOut = timedOut
+	result.DurationMs = time.Since(start).Milliseconds()
+	setExitStatus(cmd, exited, result)
+
+	if separate {
+		result.Stdout = stdout.String()
+		result.Stderr = stderr.String()
+	} else {
+		result.Output = stdout.String()
+	}
+	result.Truncated = stdout.Truncated() || stderr.Truncated()
+	return nil
+}
+
+// runPTY runs cmd on a private PTY, for programs that behave differently
+// (or refuse to run) without a terminal. Escape sequences are stripped from
+// the output.
+func (c *CommandRunner) runPTY(cmd *exec.Cmd, timeout time.Duration, result *CommandResult) error {
+	cmd.Env = append(cmd.Env, "TERM=xterm-256color")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+
+	start := time.Now()
+	ptmx, err := pty.StartWithAttrs(cmd, &pty.Winsize{Cols: 120, Rows: 40}, cmd.SysProcAttr)
+	if err != nil {
+		return fmt.Errorf("failed to start command: %w", err)
+	}
+	defer ptmx.Close()
+
+	out := newCappedBuffer(c.config.MaxOutputBytes)
+	copied := make(chan struct{})
+	go func() {
+		// Ends with EIO once the command and its children have exited
+		io.Copy(out, ptmx)
+		close(copied)
+	}()
+
+	timedOut, exited := waitWithTimeout(cmd, timeout)
+	result.TimedOut = timedOut
+	result.DurationMs = time.Since(start).Milliseconds()
+	setExitStatus(cmd, exited, result)
+
+	// Background children may keep the PTY open; don't wait for them
+	select {
+	case <-copied:
+	case <-time.After(commandOutputDelay):
+	}
+
+	result.Output = cleanTerminalOutput(out.String())
+	result.Truncated = out.Truncated()
+	return nil
+}
+
+// waitWithTimeout waits for cmd, stopping its process group if it runs
+// longer than timeout. Reports whether it timed out, and whether Wait
+// returned: a process stuck even after SIGKILL is abandoned.
+func waitWithTimeout(cmd *exec.Cmd, timeout time.Duration) (timedOut, exited bool) {
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return false, true
+	case <-time.After(timeout):
+	}
+
+	pid := cmd.Process.Pid
+	slog.Warn("[Command] Timed out, stopping", "pgid", pid, "timeout", timeout)
+	syscall.Kill(-pid, syscall.SIGTERM)
+	select {
+	case <-done:
+		return true, true
+	case <-time.After(commandKillGrace):
+	}
+
+	syscall.Kill(-pid, syscall.SIGKILL)
+	select {
+	case <-done:
+		return true, true
+	case <-time.After(commandKillGrace):
+		slog.Error("[Command] Still running after SIGKILL, abandoning it", "pgid", pid)
+		return true, false
+	}
+}
+
+// setExitStatus records how cmd ended; without exited, ProcessState is not
+// set (and may be written by the abandoned Wait)
+func setExitStatus(cmd *exec.Cmd, exited bool, result *CommandResult) {
+	if !exited {
+		result.ExitCode = -1
+		result.Signal = syscall.SIGKILL.String()
+		return
+	}
+	result.ExitCode = cmd.ProcessState.ExitCode()
+	if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		result.Signal = status.Signal().String()
+	}
+}
+
+// ansiSequence matches CSI and OSC escape sequences and other two-byte escapes
+var ansiSequence = regexp.MustCompile(`\x1b(\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[@-Z\\-_])`)
+
+// cleanTerminalOutput strips escape sequences and carriage returns from PTY
+// output
+func cleanTerminalOutput(s string) string {
+	s = ansiSequence.ReplaceAllString(s, "")
+	return strings.ReplaceAll(s, "\r\n", "\n")
+}
+
+// cappedBuffer keeps the first max bytes written to it and drops the rest
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+	mutex     sync.Mutex
+}
+
+func newCappedBuffer(max int) *cappedBuffer {
+	return &cappedBuffer{max: max}
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	room := b.max - b.buf.Len()
+	if b.max > 0 && len(p) > room {
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		b.truncated = true
+		// Report everything as written so the command isn't killed by EPIPE
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	s := b.buf.String()
+	if b.truncated {
+		s = strings.ToValidUTF8(s, "") + "\n... [output truncated]"
+	}
+	return s
+}
+
+func (b *cappedBuffer) Truncated() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.truncated
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunCommandBackgroundChild(t *testing.T) {
+	runner := NewCommandRunner(CommandsConfig{Enabled: true, TimeoutSeconds: 10, MaxTimeoutSeconds: 10, MaxOutputBytes: 1024}, func() string { return t.TempDir() })
+
+	tests := []struct {
+		name    string
+		command string
+	}{
+		{"background child holds the output", "sleep 30 & echo started"},
+		{"setsid child holds the output", "setsid sleep 30 & echo started"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			resp, err := runner.handleRunCommand(map[string]interface{}{"command": tt.command})
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := resp.(*CommandResult)
+			if result.TimedOut || result.ExitCode != 0 {
+				t.Errorf("exitCode = %d, timedOut = %v, want a clean exit", result.ExitCode, result.TimedOut)
+			}
+			if result.Output != "started\n" {
+				t.Errorf("output = %q, want %q", result.Output, "started\n")
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("took %v waiting for the child", elapsed)
+			}
+		})
+	}
+}
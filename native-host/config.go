@@ -0,0 +1,69 @@
+// Configuration
+//
+// Optional user configuration loaded from config.json in the install
+// directory. Every field has a safe default, so a missing or partial
+// file behaves like the built-in defaults.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ConfigFileName is the config file inside the install directory
+const ConfigFileName = "config.json"
+
+// Config holds the native host configuration
+type Config struct {
+	Logging   LoggingConfig   `json:"logging"`
+	Policy    PolicyConfig    `json:"policy"`
+	Metrics   MetricsConfig   `json:"metrics"`
+	Terminal  TerminalConfig  `json:"terminal"`
+	Commands  CommandsConfig  `json:"commands"`
+	Bridge    BridgeConfig    `json:"bridge"`
+	Cache     CacheConfig     `json:"cache"`
+	Artifacts ArtifactsConfig `json:"artifacts"`
+}
+
+// DefaultConfig returns the configuration used when no file is present
+func DefaultConfig() *Config {
+	return &Config{
+		Logging:   DefaultLoggingConfig(),
+		Policy:    DefaultPolicyConfig(),
+		Terminal:  DefaultTerminalConfig(),
+		Commands:  DefaultCommandsConfig(),
+		Bridge:    DefaultBridgeConfig(),
+		Cache:     DefaultCacheConfig(),
+		Artifacts: DefaultArtifactsConfig(),
+	}
+}
+
+// ConfigPath returns the path of the config file
+func ConfigPath() string {
+	return filepath.Join(GetInstallDir(), ConfigFileName)
+}
+
+// LoadConfig reads the config file. It always returns a usable config: on
+// error the defaults are returned along with the error, which callers log
+// once logging is set up.
+func LoadConfig() (*Config, error) {
+	config := DefaultConfig()
+
+	data, err := os.ReadFile(ConfigPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return config, fmt.Errorf("failed to read %s: %w", ConfigPath(), err)
+	}
+
+	// Unmarshal over the defaults so omitted fields keep their default values
+	if err := json.Unmarshal(data, config); err != nil {
+		return DefaultConfig(), fmt.Errorf("invalid %s, using defaults: %w", ConfigPath(), err)
+	}
+
+	return config, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeConfig points HOME at a temp dir holding config.json
+func writeConfig(t *testing.T, data string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	if err := os.MkdirAll(GetInstallDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(GetInstallDir(), ConfigFileName), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfigMergesProfiles(t *testing.T) {
+	writeConfig(t, `{
+		"terminal": {
+			"profiles": {
+				"gemini": {"model": "gemini-2.5-pro", "env": {"NO_COLOR": "1"}},
+				"mine": {"command": "vim", "args": ["-n"]}
+			},
+			"stopTimeoutMs": 1000
+		}
+	}`)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]LaunchProfile{
+		ProfileGemini: {
+			Command: "gemini",
+			Model:   "gemini-2.5-pro",
+			Env:     map[string]string{"FORCE_COLOR": "1", "NO_COLOR": "1"},
+		},
+		ProfileShell: {},
+		"mine":       {Command: "vim", Args: []string{"-n"}},
+	}
+	if !reflect.DeepEqual(config.Terminal.Profiles, want) {
+		t.Errorf("profiles = %+v, want %+v", config.Terminal.Profiles, want)
+	}
+	// Fields next to profiles are still read, and defaults kept
+	if config.Terminal.StopTimeoutMs != 1000 {
+		t.Errorf("stopTimeoutMs = %d, want 1000", config.Terminal.StopTimeoutMs)
+	}
+	if config.Terminal.DefaultProfile != ProfileGemini {
+		t.Errorf("defaultProfile = %q, want %q", config.Terminal.DefaultProfile, ProfileGemini)
+	}
+}
+
+func TestLoadConfigInvalidProfile(t *testing.T) {
+	writeConfig(t, `{"terminal": {"profiles": {"gemini": {"args": "not a list"}}}}`)
+
+	config, err := LoadConfig()
+	if err == nil {
+		t.Fatal("want an error for a malformed profile")
+	}
+	if got := config.Terminal.Profiles[ProfileGemini].Command; got != "gemini" {
+		t.Errorf("fell back to command %q, want the default gemini", got)
+	}
+}
+
+func TestCommandLine(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+
+	tests := []struct {
+		name     string
+		profile  LaunchProfile
+		wantPath string
+		wantArgs []string
+		wantErr  bool
+	}{
+		{"login shell", LaunchProfile{}, "/bin/sh", []string{"-l"}, false},
+		{"command with model", LaunchProfile{Command: "/bin/echo", Args: []string{"a"}, Model: "m"}, "/bin/echo", []string{"a", "--model", "m"}, false},
+		{"model without command", LaunchProfile{Model: "m"}, "", nil, true},
+		{"args without command", LaunchProfile{Args: []string{"--yolo"}}, "", nil, true},
+		{"missing command", LaunchProfile{Command: "/nonexistent/gemini"}, "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, args, err := tt.profile.commandLine()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("commandLine() = %s %q, want error", path, args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != tt.wantPath || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("commandLine() = %s %q, want %s %q", path, args, tt.wantPath, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Browser Events
+//
+// Publish/subscribe broker for events pushed by Chrome (navigation, tab
+// switches, console errors, selection changes). Socket clients subscribe
+// by topic and receive events as they arrive, in addition to the usual
+// request/response traffic.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Event topics. All but EventHost are sent by the Chrome extension.
+const (
+	EventNavigation = "navigation" // active tab navigated or finished loading
+	EventTab        = "tab"        // user switched to another tab, or closed one (closed: true)
+	EventConsole    = "console"    // console error or warning on a captured tab
+	EventSelection  = "selection"  // text selection changed on the active tab
+	EventPage       = "page"       // the active tab's content changed
+	EventHost       = "host"       // native host warnings (e.g. Chrome did not answer)
+
+	// EventAll subscribes to every topic
+	EventAll = "*"
+)
+
+// eventTopics lists the topics clients may subscribe to
+var eventTopics = map[string]bool{
+	EventNavigation: true,
+	EventTab:        true,
+	EventConsole:    true,
+	EventSelection:  true,
+	EventPage:       true,
+	EventHost:       true,
+	EventAll:        true,
+}
+
+// eventBufferSize is the number of events queued per subscriber before
+// newer events are dropped
+const eventBufferSize = 64
+
+// BrowserEvent is an event published by Chrome
+type BrowserEvent struct {
+	Type      string      `json:"type"`
+	Topic     string      `json:"topic"`
+	Data      interface{} `json:"data,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// EventSubscription receives the events for its topics on C
+type EventSubscription struct {
+	C      <-chan BrowserEvent
+	ch     chan BrowserEvent
+	topics map[string]bool
+	id     int
+}
+
+// EventBroker fans out Chrome events to subscribers
+type EventBroker struct {
+	subscriptions map[int]*EventSubscription
+	nextId        int
+	mutex         sync.RWMutex
+}
+
+// NewEventBroker creates an empty broker
+func NewEventBroker() *EventBroker {
+	return &EventBroker{
+		subscriptions: make(map[int]*EventSubscription),
+	}
+}
+
+// Subscribe creates a subscription with no topics
+func (b *EventBroker) Subscribe() *EventSubscription {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.nextId++
+	ch := make(chan BrowserEvent, eventBufferSize)
+	sub := &EventSubscription{
+		C:      ch,
+		ch:     ch,
+		topics: make(map[string]bool),
+		id:     b.nextId,
+	}
+	b.subscriptions[sub.id] = sub
+	return sub
+}
+
+// SetTopics adds (or, with subscribe false, removes) topics from a
+// subscription and returns the resulting topic list
+func (b *EventBroker) SetTopics(sub *EventSubscription, topics []string, subscribe bool) ([]string, error) {
+	for _, topic := range topics {
+		if !eventTopics[topic] {
+			return nil, fmt.Errorf("unknown event topic: %s", topic)
+		}
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, topic := range topics {
+		if subscribe {
+			sub.topics[topic] = true
+		} else {
+			delete(sub.topics, topic)
+		}
+	}
+
+	current := make([]string, 0, len(sub.topics))
+	for topic := range sub.topics {
+		current = append(current, topic)
+	}
+	sort.Strings(current)
+	return current, nil
+}
+
+// Unsubscribe removes a subscription and closes its channel
+func (b *EventBroker) Unsubscribe(sub *EventSubscription) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, ok := b.subscriptions[sub.id]; ok {
+		delete(b.subscriptions, sub.id)
+		close(sub.ch)
+	}
+}
+
+// Publish delivers an event to every subscriber of its topic. Slow
+// subscribers lose events rather than blocking the Native Messaging loop.
+func (b *EventBroker) Publish(event BrowserEvent) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	for _, sub := range b.subscriptions {
+		if !sub.topics[event.Topic] && !sub.topics[EventAll] {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			slog.Warn("[Events] Subscriber queue full, dropping event", "topic", event.Topic, "subscription", sub.id)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Context Injection
+//
+// Handles terminal:inject from the side panel: fetches the active tab's
+// URL, selection and page text through the socket server's request path
+// (so the policy and audit log apply as for MCP clients) and pastes a
+// formatted block into the running Gemini CLI prompt. The block is sent
+// as a paste so newlines don't submit the prompt.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// DefaultInjectMaxChars bounds each injected section
+const DefaultInjectMaxChars = 8000
+
+// injectClient names context injection in the audit log
+const injectClient = "side-panel"
+
+// injectContext builds the context block and writes it to the PTY.
+// By default the URL and selection are sent, falling back to the page text
+// when nothing is selected.
+func injectContext(server *SocketServer, ptyManager *PTYManager, requestId string, params InjectParams) error {
+	sources := map[string]bool{}
+	for _, source := range params.Sources {
+		sources[source] = true
+	}
+	fallbackToText := false
+	if len(sources) == 0 {
+		sources["url"] = true
+		sources["selection"] = true
+		fallbackToText = true
+	}
+
+	maxChars := DefaultInjectMaxChars
+	if params.MaxChars > 0 {
+		maxChars = params.MaxChars
+	}
+
+	var url, title, selection, text string
+
+	if sources["url"] {
+		data, err := requestData(server, requestId, "getUrl", nil)
+		if err != nil {
+			return err
+		}
+		url, _ = data["url"].(string)
+		title, _ = data["title"].(string)
+	}
+
+	if sources["selection"] {
+		data, err := requestData(server, requestId, "getSelection", nil)
+		if err != nil {
+			return err
+		}
+		selection, _ = data["text"].(string)
+		if strings.TrimSpace(selection) == "" && fallbackToText {
+			sources["text"] = true
+		}
+	}
+
+	if sources["text"] {
+		data, err := requestData(server, requestId, "getPageText", map[string]interface{}{"maxLength": maxChars})
+		if err != nil {
+			return err
+		}
+		text, _ = data["text"].(string)
+		if title == "" {
+			title, _ = data["title"].(string)
+		}
+	}
+
+	block := formatInjectedContext(title, url, truncateRunes(selection, maxChars), truncateRunes(text, maxChars))
+	if block == "" {
+		return fmt.Errorf("nothing to send: the page has no URL, selection or text")
+	}
+
+	slog.Info("[Inject] Pasting browser context into terminal", "chars", len(block))
+	return ptyManager.Paste([]byte(block))
+}
+
+// requestData runs a browser action as a socket request would, checked by
+// the policy and recorded in the audit log, and returns its data object
+func requestData(server *SocketServer, requestId, action string, params interface{}) (map[string]interface{}, error) {
+	resp := server.handleRequest(SocketMessage{RequestId: requestId, Action: action, Params: params}, injectClient)
+	if !resp.Success {
+		return nil, fmt.Errorf("%s failed: %s", action, resp.Error)
+	}
+	data, _ := resp.Data.(map[string]interface{})
+	return data, nil
+}
+
+// formatInjectedContext lays out the pasted block
+func formatInjectedContext(title, url, selection, text string) string {
+	var b strings.Builder
+
+	if title != "" || url != "" {
+		b.WriteString("Context from the browser")
+		if title != "" {
+			b.WriteString(": " + sanitizeForPaste(title))
+		}
+		b.WriteString("\n")
+		if url != "" {
+			b.WriteString("URL: " + sanitizeForPaste(url) + "\n")
+		}
+	}
+	if strings.TrimSpace(selection) != "" {
+		b.WriteString("\nSelected text:\n" + sanitizeForPaste(selection) + "\n")
+	}
+	if strings.TrimSpace(text) != "" {
+		b.WriteString("\nPage text:\n" + sanitizeForPaste(text) + "\n")
+	}
+
+	return b.String()
+}
+
+// sanitizeForPaste removes control characters (including ESC, which could
+// end the bracketed paste early) while keeping newlines and tabs
+func sanitizeForPaste(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if r < 0x20 || r == 0x7f || (r >= 0x80 && r < 0xa0) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// truncateRunes shortens s to at most max characters
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max]) + "\n... [truncated]"
+}
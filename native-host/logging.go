@@ -0,0 +1,130 @@
+// Logging
+//
+// Structured, leveled logging via log/slog. Each mode writes to its own
+// size-rotated file, the level follows --debug or config.json, and values
+// that may carry page contents or scripts are redacted before writing.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const (
+	// HostLogFile is used in Native Messaging mode
+	HostLogFile = "/tmp/gemini-browser-host.log"
+	// MCPLogFile is used in MCP Server mode
+	MCPLogFile = "/tmp/gemini-browser-mcp.log"
+)
+
+// LoggingConfig holds the logging section of config.json
+type LoggingConfig struct {
+	// Level is debug, info, warn or error (--debug forces debug)
+	Level string `json:"level"`
+	// Format is text or json
+	Format     string `json:"format"`
+	MaxSizeMB  int    `json:"maxSizeMB"`
+	MaxBackups int    `json:"maxBackups"`
+	// MCPConsole forwards page console messages to MCP clients as log
+	// notifications (off: pages can be chatty)
+	MCPConsole bool `json:"mcpConsole"`
+}
+
+// DefaultLoggingConfig returns the logging defaults
+func DefaultLoggingConfig() LoggingConfig {
+	return LoggingConfig{
+		Level:      "info",
+		Format:     "text",
+		MaxSizeMB:  10,
+		MaxBackups: 3,
+	}
+}
+
+// redactedLogKeys name attributes whose values may contain scripts or page
+// contents; only their size is logged
+var redactedLogKeys = map[string]bool{
+	"script":  true,
+	"content": true,
+	"text":    true,
+	"html":    true,
+	"value":   true,
+	"body":    true,
+	"data":    true,
+}
+
+// setupLogging installs the default slog logger writing to path. It returns
+// the underlying file so it can be closed on shutdown.
+func setupLogging(path string, config LoggingConfig, debug bool) io.Closer {
+	level := parseLogLevel(config.Level)
+	if debug {
+		level = slog.LevelDebug
+	}
+
+	if config.MaxSizeMB <= 0 {
+		config.MaxSizeMB = DefaultLoggingConfig().MaxSizeMB
+	}
+
+	var out io.Writer = os.Stderr
+	var closer io.Closer = io.NopCloser(nil)
+	file, err := NewRotatingFile(path, int64(config.MaxSizeMB)*1024*1024, config.MaxBackups)
+	if err == nil {
+		out, closer = file, file
+	}
+	// Never fall back to stdout: Native Messaging and MCP both use it
+
+	options := &slog.HandlerOptions{
+		Level:       level,
+		AddSource:   level == slog.LevelDebug,
+		ReplaceAttr: redactLogAttr,
+	}
+
+	var handler slog.Handler
+	if strings.EqualFold(config.Format, "json") {
+		handler = slog.NewJSONHandler(out, options)
+	} else {
+		handler = slog.NewTextHandler(out, options)
+	}
+
+	logger := slog.New(handler).With("pid", os.Getpid())
+	slog.SetDefault(logger)
+	// Route any stray log.Printf (e.g. from dependencies) through slog
+	log.SetFlags(0)
+
+	if err != nil {
+		slog.Warn("[Main] Cannot open log file, logging to stderr", "path", path, "error", err)
+	}
+	return closer
+}
+
+func parseLogLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// redactLogAttr replaces sensitive attribute values with their size
+func redactLogAttr(groups []string, attr slog.Attr) slog.Attr {
+	if !redactedLogKeys[attr.Key] {
+		return attr
+	}
+	switch v := attr.Value.Any().(type) {
+	case string:
+		return slog.String(attr.Key, fmt.Sprintf("[redacted %d chars]", len(v)))
+	case []byte:
+		return slog.String(attr.Key, fmt.Sprintf("[redacted %d bytes]", len(v)))
+	default:
+		return slog.String(attr.Key, "[redacted]")
+	}
+}
@@ -9,21 +9,25 @@
 // 2. MCP Server mode (--mcp-mode): Launched by Gemini CLI
 //    - Implements MCP JSON-RPC protocol
 //    - Connects to Native Host via Unix socket for browser context
+//
+// `gemini-browser-host replay <file.cast>` plays back a recorded terminal session.
 
 package main
 
 import (
+	"encoding/base64"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 )
 
 const (
 	SocketPath = "/tmp/gemini-browser.sock"
-	LogFile    = "/tmp/gemini-browser-host.log"
 )
 
 var (
@@ -32,59 +36,178 @@ var (
 )
 
 func main() {
-	// Setup logging FIRST so we can debug startup issues
-	setupLogging()
-
-	log.Printf("[Main] Starting with args: %v", os.Args)
+	// Subcommands run in the user's terminal, without config or logging
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(runReplay(os.Args[2:]))
+	}
 
 	flag.Parse()
 
+	config, configErr := LoadConfig()
+
+	// Setup logging before anything else so we can debug startup issues.
+	// Each mode gets its own log file.
+	logPath := HostLogFile
 	if *mcpMode {
-		log.Println("[Main] Starting in MCP Server mode")
-		runMCPMode()
+		logPath = MCPLogFile
+	}
+	logCloser := setupLogging(logPath, config.Logging, *debug)
+	defer logCloser.Close()
+
+	slog.Info("[Main] Starting", "args", os.Args)
+	if configErr != nil {
+		slog.Warn("[Main] Config error", "error", configErr)
+	}
+
+	if *mcpMode {
+		slog.Info("[Main] Starting in MCP Server mode")
+		runMCPMode(config)
 	} else {
-		log.Println("[Main] Starting in Native Messaging mode")
-		runNativeMessagingMode()
+		slog.Info("[Main] Starting in Native Messaging mode")
+		runNativeMessagingMode(config)
 	}
 }
 
-func setupLogging() {
-	logFile, err := os.OpenFile(LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+func runNativeMessagingMode(config *Config) {
+	// Announce the protocol version and capabilities before anything else,
+	// so the extension can tell whether it understands this host
+	if err := WriteNativeMessage(os.Stdout, NewHostHello()); err != nil {
+		slog.Error("[Main] Failed to write hello", "error", err)
+	}
+
+	// Create the bridge that coordinates everything
+	bridge := NewBrowserBridge(config.Bridge, config.Cache)
+
+	// Permission policy for actions requested by MCP clients
+	policy := NewPolicyEngine(config.Policy, bridge)
+
+	// Audit log of every action requested by MCP clients
+	audit, err := NewAuditLog(AuditLogPath())
 	if err != nil {
-		// Can't log to file, use stderr (but be careful - Native Messaging uses stdin/stdout)
-		log.SetOutput(os.Stderr)
-		return
+		slog.Warn("[Main] Audit log disabled", "error", err)
 	}
-	log.SetOutput(logFile)
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-}
 
-func runNativeMessagingMode() {
-	// Clean up old socket if exists
-	os.Remove(SocketPath)
+	// PTY manager for the terminal session
+	ptyManager := NewPTYManager(time.Duration(config.Terminal.StopTimeoutMs) * time.Millisecond)
+	if rec := config.Terminal.Recording; rec.AutoStart {
+		ptyManager.StartRecording(rec.RecordingsDir(), rec.Input)
+	}
 
-	// Create the bridge that coordinates everything
-	bridge := NewBrowserBridge()
+	// Each host gets its own socket in the registry, so several browsers
+	// or profiles can run side by side
+	registration, err := RegisterHost()
+	if err != nil {
+		slog.Error("[Main] Failed to register host", "error", err)
+		audit.Close()
+		os.Exit(1)
+	}
 
-	// Start Unix socket server for MCP clients
-	socketServer := NewSocketServer(SocketPath, bridge)
+	// Start Unix socket server for MCP clients. The terminal screen is
+	// served locally.
+	socketServer := NewSocketServer(registration.SocketPath(), bridge, policy, audit)
+	socketServer.HandleLocal("getTerminalScreen", ptyManager.handleTerminalScreen)
+	commands := NewCommandRunner(config.Commands, ptyManager.Cwd)
+	socketServer.HandleLocal("runCommand", commands.handleRunCommand)
 	go socketServer.Start()
+	registration.ClaimLegacySocket()
+
+	// shutdown releases what this host shares with other hosts and MCP
+	// servers, on every way out
+	shutdown := func() {
+		socketServer.Stop()
+		audit.Close()
+		registration.Close()
+	}
+
+	// Start the default launch profile. If it can't start (e.g. Gemini CLI
+	// is not installed), report why and open a shell instead.
+	terminalErr := startTerminal(ptyManager, config.Terminal, "", "")
+	if terminalErr != nil && config.Terminal.DefaultProfile != ProfileShell {
+		if err := startTerminal(ptyManager, config.Terminal, ProfileShell, ""); err != nil {
+			shutdown()
+			os.Exit(1)
+		}
+	} else if terminalErr != nil {
+		shutdown()
+		os.Exit(1)
+	}
 
-	// Start PTY manager
-	ptyManager := NewPTYManager()
-	if err := ptyManager.Start(); err != nil {
-		log.Fatalf("[Main] Failed to start PTY: %v", err)
+	// Ping the extension so requests fail fast when it stops answering
+	stopHeartbeat := make(chan struct{})
+	go bridge.Heartbeat(stopHeartbeat)
+
+	// Health gauges sampled whenever status is requested
+	hostMetrics.RegisterGauge("pending_requests", func() float64 {
+		return float64(bridge.GetPendingCount())
+	})
+	hostMetrics.RegisterGauge("queued_requests", func() float64 {
+		return float64(bridge.QueueLength())
+	})
+	hostMetrics.RegisterGauge("extension_alive", func() float64 {
+		if bridge.checkAlive() == nil {
+			return 1
+		}
+		return 0
+	})
+	hostMetrics.RegisterGauge("pty_running", func() float64 {
+		if ptyManager.IsRunning() {
+			return 1
+		}
+		return 0
+	})
+	if config.Metrics.PrometheusAddr != "" {
+		if err := hostMetrics.StartPrometheus(config.Metrics.PrometheusAddr); err != nil {
+			slog.Warn("[Main] Metrics endpoint disabled", "error", err)
+		}
 	}
 
-	// Connect PTY output to Native Messaging
+	// Report sessions that end on their own and restart them per the policy
+	restarts := newRestartTracker(config.Terminal.Restart)
+	handleExit := func(exit PTYExit) {
+		delay, restart, reason := restarts.next(exit)
+		data := map[string]interface{}{
+			"profile":  exit.Profile,
+			"cwd":      exit.Cwd,
+			"code":     exit.Code,
+			"uptimeMs": exit.UptimeMs,
+		}
+		if exit.Signal != "" {
+			data["signal"] = exit.Signal
+		}
+		if restart {
+			data["restartInMs"] = delay.Milliseconds()
+		}
+		if reason != "" {
+			data["reason"] = reason
+		}
+		slog.Info("[Main] Terminal exited", "profile", exit.Profile, "code", exit.Code, "signal", exit.Signal, "restart", restart, "delay", delay)
+		if err := WriteNativeMessage(os.Stdout, Message{Type: "terminal:exit", Data: data}); err != nil {
+			slog.Error("[Main] Failed to write terminal exit", "error", err)
+		}
+
+		if restart {
+			time.AfterFunc(delay, func() {
+				// The user may have started another session meanwhile
+				if ptyManager.Generation() == exit.Generation {
+					restartTerminal(ptyManager, config.Terminal)
+				}
+			})
+		}
+	}
+
+	// Connect PTY output (and exits) to Native Messaging
 	go func() {
 		for output := range ptyManager.OutputChan() {
+			if output.Exit != nil {
+				handleExit(*output.Exit)
+				continue
+			}
 			msg := Message{
 				Type: "terminal:output",
-				Data: output,
+				Data: output.Data,
 			}
 			if err := WriteNativeMessage(os.Stdout, msg); err != nil {
-				log.Printf("[Main] Failed to write terminal output: %v", err)
+				slog.Error("[Main] Failed to write terminal output", "error", err)
 			}
 		}
 	}()
@@ -94,54 +217,270 @@ func runNativeMessagingMode() {
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		<-sigChan
-		log.Println("[Main] Shutting down...")
+		slog.Info("[Main] Shutting down")
 		ptyManager.Stop()
-		socketServer.Stop()
-		os.Remove(SocketPath)
+		shutdown()
 		os.Exit(0)
 	}()
 
 	// Main loop: read from Chrome (Native Messaging) and dispatch
 	for {
-		msg, err := ReadNativeMessage(os.Stdin)
+		raw, err := ReadNativeMessage(os.Stdin)
 		if err != nil {
-			log.Printf("[Main] Failed to read Native Message: %v", err)
+			slog.Info("[Main] Native Messaging input closed", "error", err)
 			break
 		}
 
-		log.Printf("[Main] Received message type: %s", msg.Type)
+		bridge.MarkAlive()
+
+		msg, err := DecodeMessage(raw)
+		if err != nil {
+			reportProtocolError(bridge, err)
+			continue
+		}
+
+		slog.Debug("[Main] Received message", "type", msg.MessageType())
+
+		switch msg := msg.(type) {
+		case *HelloMessage:
+			// The extension's protocol version and capabilities
+			slog.Info("[Main] Extension connected", "browser", msg.Browser, "instanceId", msg.InstanceId, "version", msg.Version, "protocol", msg.ProtocolVersion, "capabilities", msg.Capabilities)
+			bridge.SetExtension(msg)
+			registration.Update(msg)
+			if err := msg.CheckCompatible(); err != nil {
+				reportProtocolError(bridge, err)
+			}
 
-		switch msg.Type {
-		case "terminal:input":
-			// Forward to PTY
-			if data, ok := msg.Data.(string); ok {
-				ptyManager.Write([]byte(data))
+		case *TerminalInputMessage:
+			// Forward to PTY. Queued, so a large paste doesn't hold up
+			// this loop.
+			data, err := terminalInput(msg)
+			if err != nil {
+				slog.Warn("[Main] Invalid terminal input", "error", err)
+			} else if msg.Paste {
+				ptyManager.SendPaste(data)
+			} else if len(data) > 0 {
+				ptyManager.SendInput(data)
 			}
 
-		case "terminal:resize":
+		case *TerminalResizeMessage:
 			// Resize PTY
-			if cols, ok := msg.Cols.(float64); ok {
-				if rows, ok := msg.Rows.(float64); ok {
-					ptyManager.Resize(int(cols), int(rows))
+			if msg.Cols > 0 && msg.Rows > 0 {
+				ptyManager.Resize(msg.Cols, msg.Rows)
+			}
+
+		case *TerminalSignalMessage:
+			// Interrupt or suspend the foreground process (Ctrl-C doesn't
+			// reach programs that read the keyboard in raw mode)
+			name := msg.Params.Signal
+			if err := ptyManager.Signal(name); err != nil {
+				slog.Warn("[Main] Failed to signal terminal", "signal", name, "error", err)
+				reply := Message{Type: "terminal:error", Error: fmt.Sprintf("Cannot send %s: %v", name, err)}
+				if err := WriteNativeMessage(os.Stdout, reply); err != nil {
+					slog.Error("[Main] Failed to write terminal status", "error", err)
+				}
+			}
+
+		case *TerminalRecordingMessage:
+			// Start or stop recording sessions; any other action just
+			// reports the state
+			reply := Message{Type: "terminal:recording", RequestId: msg.RequestId, Success: true}
+			data := map[string]interface{}{}
+			switch msg.Params.Action {
+			case "start":
+				rec := config.Terminal.Recording
+				input := rec.Input
+				if msg.Params.Input != nil {
+					input = *msg.Params.Input
+				}
+				if _, err := ptyManager.StartRecording(rec.RecordingsDir(), input); err != nil {
+					slog.Warn("[Main] Failed to start recording", "error", err)
+					reply.Success = false
+					reply.Error = err.Error()
+				}
+			case "stop":
+				if path := ptyManager.StopRecording(); path != "" {
+					data["saved"] = path
 				}
 			}
+			recording, path := ptyManager.Recording()
+			data["recording"] = recording
+			data["path"] = path
+			reply.Data = data
+			if err := WriteNativeMessage(os.Stdout, reply); err != nil {
+				slog.Error("[Main] Failed to write recording status", "error", err)
+			}
+
+		case *TerminalStartMessage:
+			// Replace the running session with another launch profile and/or
+			// working directory
+			restarts.reset()
+			if err := startTerminal(ptyManager, config.Terminal, msg.Params.Profile, msg.Params.Cwd); err == nil {
+				terminalErr = nil
+			}
 
-		case "browser:response":
-			// Forward response to waiting MCP client
-			if reqID, ok := msg.RequestId.(string); ok {
-				bridge.HandleResponse(reqID, *msg)
+		case *TerminalRestartMessage:
+			// Start the last session again (same profile and directory)
+			restarts.reset()
+			if err := restartTerminal(ptyManager, config.Terminal); err == nil {
+				terminalErr = nil
 			}
 
-		default:
-			log.Printf("[Main] Unknown message type: %s", msg.Type)
+		case *TerminalProfilesMessage:
+			// Side panel asks what it can start (and why the last start failed)
+			data := map[string]interface{}{
+				"profiles":       config.Terminal.ProfileNames(),
+				"defaultProfile": config.Terminal.DefaultProfile,
+				"current":        ptyManager.Profile(),
+				"workspaces":     config.Terminal.WorkspaceList(),
+				"cwd":            ptyManager.Cwd(),
+			}
+			if terminalErr != nil {
+				data["error"] = terminalErr.Error()
+			}
+			if err := WriteNativeMessage(os.Stdout, Message{Type: "terminal:profiles", Data: data}); err != nil {
+				slog.Error("[Main] Failed to write profiles", "error", err)
+			}
+
+		case *TerminalInjectMessage:
+			// Paste browser context into the prompt. Runs in the background
+			// because the bridge replies arrive through this loop.
+			go func(msg *TerminalInjectMessage) {
+				reply := Message{Type: "terminal:inject", RequestId: msg.RequestId, Success: true}
+				if err := injectContext(socketServer, ptyManager, msg.RequestId, msg.Params); err != nil {
+					slog.Warn("[Main] Context injection failed", "error", err)
+					reply.Success = false
+					reply.Error = err.Error()
+				}
+				if err := WriteNativeMessage(os.Stdout, reply); err != nil {
+					slog.Error("[Main] Failed to write inject result", "error", err)
+				}
+			}(msg)
+
+		case *BrowserResponse:
+			// Forward response (or approval decision) to the waiting request
+			bridge.HandleResponse(msg)
+
+		case *BrowserEventMessage:
+			// Navigation, tab, console and selection events for subscribers
+			bridge.HandleEvent(msg)
+
+		case *HostPongMessage:
+			bridge.HandlePong(msg)
+		}
+	}
+	close(stopHeartbeat)
+	bridge.Close()
+
+	// Chrome is gone: let the terminal process save its state and exit
+	ptyManager.Stop()
+	shutdown()
+}
+
+// terminalInput returns the bytes of a terminal:input message: dataBase64
+// when present (for input that isn't valid UTF-8), otherwise data
+func terminalInput(msg *TerminalInputMessage) ([]byte, error) {
+	if msg.DataBase64 != "" {
+		data, err := base64.StdEncoding.DecodeString(msg.DataBase64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dataBase64: %w", err)
+		}
+		return data, nil
+	}
+	return []byte(msg.Data), nil
+}
+
+// reportProtocolError tells the side panel about a message the host can't
+// handle, naming both protocol versions since a mismatch is the usual cause
+func reportProtocolError(bridge *BrowserBridge, err error) {
+	data := map[string]interface{}{
+		"hostVersion":     HostVersion,
+		"protocolVersion": ProtocolVersion,
+	}
+	detail := fmt.Sprintf("native host protocol v%d", ProtocolVersion)
+	if ext := bridge.Extension(); ext != nil {
+		data["extensionVersion"] = ext.Version
+		data["extensionProtocolVersion"] = ext.ProtocolVersion
+		detail += fmt.Sprintf(", extension protocol v%d", ext.ProtocolVersion)
+	} else {
+		detail += ", extension sent no hello"
+	}
+
+	slog.Warn("[Main] Protocol error", "error", err, "extension", bridge.Extension() != nil)
+	msg := Message{Type: "protocol:error", Error: fmt.Sprintf("%v (%s)", err, detail), Data: data}
+	if writeErr := WriteNativeMessage(os.Stdout, msg); writeErr != nil {
+		slog.Error("[Main] Failed to write protocol error", "error", writeErr)
+	}
+}
+
+// startTerminal starts a launch profile (the default one when name is empty)
+// and tells the side panel whether it worked. An explicit cwd becomes the
+// remembered workspace.
+func startTerminal(ptyManager *PTYManager, terminal TerminalConfig, name, cwd string) error {
+	profile, name, err := terminal.Profile(name)
+	dir := ""
+	if err == nil {
+		dir, err = resolveWorkspace(cwd, profile)
+	}
+	if err == nil {
+		err = ptyManager.Start(name, profile, dir)
+	}
+	if err == nil && cwd != "" {
+		if saveErr := SaveState(HostState{LastWorkspace: dir}); saveErr != nil {
+			slog.Warn("[Main] Failed to remember workspace", "error", saveErr)
+		}
+	}
+
+	reportTerminalStart(ptyManager, name, dir, err)
+	return err
+}
+
+// restartTerminal starts the last session's profile again in the same
+// directory, without changing the remembered workspace
+func restartTerminal(ptyManager *PTYManager, terminal TerminalConfig) error {
+	profile, name, err := terminal.Profile(ptyManager.Profile())
+	dir := ptyManager.Cwd()
+	if err == nil && dir == "" {
+		dir, err = resolveWorkspace("", profile)
+	}
+	if err == nil {
+		err = ptyManager.Start(name, profile, dir)
+	}
+
+	reportTerminalStart(ptyManager, name, dir, err)
+	return err
+}
+
+// reportTerminalStart sends terminal:started or terminal:error to the side
+// panel, and a failed terminal:recording if recording couldn't carry over
+// to the new session
+func reportTerminalStart(ptyManager *PTYManager, name, dir string, err error) {
+	msg := Message{Type: "terminal:started", Data: map[string]interface{}{"profile": name, "cwd": dir}}
+	if err != nil {
+		slog.Error("[Main] Failed to start terminal", "profile", name, "error", err)
+		msg.Type = "terminal:error"
+		msg.Error = fmt.Sprintf("Cannot start %s: %v", name, err)
+	}
+	if writeErr := WriteNativeMessage(os.Stdout, msg); writeErr != nil {
+		slog.Error("[Main] Failed to write terminal status", "error", writeErr)
+	}
+
+	if recErr := ptyManager.RecordingError(); err == nil && recErr != nil {
+		msg := Message{
+			Type:  "terminal:recording",
+			Error: fmt.Sprintf("recording stopped: %v", recErr),
+			Data:  map[string]interface{}{"recording": false, "path": ""},
+		}
+		if writeErr := WriteNativeMessage(os.Stdout, msg); writeErr != nil {
+			slog.Error("[Main] Failed to write recording status", "error", writeErr)
 		}
 	}
 }
 
-func runMCPMode() {
+func runMCPMode(config *Config) {
 	// In MCP mode, we connect to the Native Host's socket
 	// and implement the MCP JSON-RPC protocol
-	mcpServer := NewMCPServer(SocketPath)
+	mcpServer := NewMCPServer(config)
 	mcpServer.Run()
 }
 
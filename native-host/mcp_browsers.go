@@ -0,0 +1,100 @@
+// MCP Browser Selection
+//
+// Several browsers or Chrome profiles can each run a native host. The MCP
+// server talks to one of them at a time: the one named by select_browser
+// (or the GEMINI_BROWSER environment variable), otherwise the default host
+// from the registry.
+
+package main
+
+import (
+	"log/slog"
+)
+
+// hostSocket returns the socket of the selected browser's host. Without
+// registry entries (a host from before the registry) the legacy socket is
+// used.
+func (s *MCPServer) hostSocket() (string, error) {
+	s.connMutex.Lock()
+	target := s.target
+	s.connMutex.Unlock()
+
+	hosts := ListHosts()
+	if len(hosts) == 0 && target == "" {
+		return SocketPath, nil
+	}
+	host, err := findHost(hosts, target)
+	if err != nil {
+		return "", err
+	}
+	return host.Socket, nil
+}
+
+// currentSocket returns the socket of the current (or last) connection
+func (s *MCPServer) currentSocket() string {
+	s.connMutex.Lock()
+	defer s.connMutex.Unlock()
+	return s.socketPath
+}
+
+// handleListBrowsers lists the running hosts and which one is selected
+func (s *MCPServer) handleListBrowsers(id interface{}) *JSONRPCResponse {
+	hosts := ListHosts()
+	current := ""
+	if s.connected() {
+		current = s.currentSocket()
+	}
+
+	browsers := make([]map[string]interface{}, 0, len(hosts))
+	for _, host := range hosts {
+		browsers = append(browsers, map[string]interface{}{
+			"id":               host.Id,
+			"browser":          host.Browser,
+			"extensionVersion": host.ExtensionVersion,
+			"pid":              host.Pid,
+			"startedAt":        host.StartedAt,
+			"default":          host.Legacy,
+			"selected":         host.Socket == current,
+		})
+	}
+	return s.textResponse(id, map[string]interface{}{
+		"browsers": browsers,
+		"count":    len(browsers),
+	})
+}
+
+// handleSelectBrowser routes the following calls to another browser's host
+func (s *MCPServer) handleSelectBrowser(id interface{}, args map[string]interface{}) *JSONRPCResponse {
+	name, _ := args["browser"].(string)
+	host, err := findHost(ListHosts(), name)
+	if err != nil {
+		return s.errorResponse(id, -32000, err.Error())
+	}
+
+	// Remember the id rather than the socket: the host gets a new socket
+	// whenever Chrome restarts it, while the extension's id stays
+	s.dialMutex.Lock()
+	defer s.dialMutex.Unlock()
+	s.connMutex.Lock()
+	if name == "" {
+		s.target = ""
+	} else {
+		s.target = host.Id
+	}
+	old := s.conn
+	s.connMutex.Unlock()
+
+	if old != nil {
+		s.closeConn(old)
+	}
+	if err := s.dial(); err != nil {
+		return s.errorResponse(id, -32000, "Cannot connect to "+host.Id+": "+err.Error())
+	}
+
+	slog.Info("[MCP] Selected browser", "id", host.Id, "browser", host.Browser, "pid", host.Pid)
+	return s.textResponse(id, map[string]interface{}{
+		"selected": host.Id,
+		"browser":  host.Browser,
+		"pid":      host.Pid,
+	})
+}
@@ -0,0 +1,107 @@
+// MCP Logging
+//
+// Implements the MCP logging capability: the client picks a minimum level
+// with logging/setLevel and receives notifications/message for connection
+// changes, native host warnings (such as bridge timeouts) and, when
+// logging.mcpConsole is set, live console errors from the page.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+)
+
+// mcpLogLevels are the MCP (syslog) levels, least severe first
+var mcpLogLevels = []string{"debug", "info", "notice", "warning", "error", "critical", "alert", "emergency"}
+
+// DefaultMCPLogLevel is used until the client calls logging/setLevel
+const DefaultMCPLogLevel = "info"
+
+// logTopics returns the host events forwarded as log messages
+func (s *MCPServer) logTopics() []string {
+	if s.consoleLogs {
+		return []string{EventHost, EventConsole}
+	}
+	return []string{EventHost}
+}
+
+// consoleLogLevels maps get_console_logs levels to MCP levels
+var consoleLogLevels = map[string]string{
+	"error":   "error",
+	"warning": "warning",
+	"info":    "info",
+	"log":     "info",
+	"debug":   "debug",
+}
+
+func mcpLogLevelRank(level string) int {
+	for i, l := range mcpLogLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *MCPServer) handleSetLogLevel(req JSONRPCRequest) *JSONRPCResponse {
+	var params struct {
+		Level string `json:"level"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil || mcpLogLevelRank(params.Level) < 0 {
+		return s.errorResponse(req.ID, -32602, fmt.Sprintf("Invalid log level: %q", params.Level))
+	}
+
+	s.subsMutex.Lock()
+	s.logLevel = params.Level
+	s.subsMutex.Unlock()
+
+	slog.Info("[MCP] Client log level set", "level", params.Level)
+	return &JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result:  map[string]interface{}{},
+	}
+}
+
+// logToClient sends a notifications/message if level passes the client's filter
+func (s *MCPServer) logToClient(level, logger string, data interface{}) {
+	s.subsMutex.Lock()
+	minLevel := s.logLevel
+	s.subsMutex.Unlock()
+
+	if mcpLogLevelRank(level) < mcpLogLevelRank(minLevel) {
+		return
+	}
+	s.sendNotification("notifications/message", map[string]interface{}{
+		"level":  level,
+		"logger": logger,
+		"data":   data,
+	})
+}
+
+// logBrowserEvent forwards host warnings and console messages to the client
+func (s *MCPServer) logBrowserEvent(event BrowserEvent) {
+	data, _ := event.Data.(map[string]interface{})
+
+	switch event.Topic {
+	case EventHost:
+		level, _ := data["level"].(string)
+		if mcpLogLevelRank(level) < 0 {
+			level = "info"
+		}
+		s.logToClient(level, "native-host", data)
+
+	case EventConsole:
+		if !s.consoleLogs {
+			return
+		}
+		consoleLevel, _ := data["level"].(string)
+		level, ok := consoleLogLevels[consoleLevel]
+		if !ok {
+			level = "info"
+		}
+		s.logToClient(level, "browser-console", data)
+	}
+}
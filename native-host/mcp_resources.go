@@ -0,0 +1,228 @@
+// MCP Resources
+//
+// Exposes live browser state (active tab, selection, console errors) as
+// MCP resources. Clients that subscribe get notifications/resources/updated
+// when Chrome publishes a matching event, instead of polling tools.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// browserResource is a resource backed by a browser action
+type browserResource struct {
+	URI         string
+	Name        string
+	Description string
+	Action      string
+	Params      map[string]interface{}
+	// Topics are the events after which the resource should be re-read
+	Topics []string
+}
+
+var browserResources = []browserResource{
+	{
+		URI:         "browser://active-tab",
+		Name:        "Active tab",
+		Description: "URL and title of the active browser tab",
+		Action:      "getUrl",
+		Topics:      []string{EventNavigation, EventTab},
+	},
+	{
+		URI:         "browser://selection",
+		Name:        "Selection",
+		Description: "Text currently selected in the active tab",
+		Action:      "getSelection",
+		Topics:      []string{EventSelection, EventNavigation, EventTab},
+	},
+	{
+		URI:         "browser://console-errors",
+		Name:        "Console errors",
+		Description: "Console errors captured on the active tab",
+		Action:      "getConsoleLogs",
+		Params:      map[string]interface{}{"level": "error"},
+		Topics:      []string{EventConsole, EventTab},
+	},
+}
+
+func findBrowserResource(uri string) *browserResource {
+	for i := range browserResources {
+		if browserResources[i].URI == uri {
+			return &browserResources[i]
+		}
+	}
+	return nil
+}
+
+func (s *MCPServer) handleResourcesList(req JSONRPCRequest) *JSONRPCResponse {
+	resources := make([]map[string]interface{}, 0, len(browserResources))
+	for _, r := range browserResources {
+		resources = append(resources, map[string]interface{}{
+			"uri":         r.URI,
+			"name":        r.Name,
+			"description": r.Description,
+			"mimeType":    "application/json",
+		})
+	}
+
+	return &JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"resources": resources,
+		},
+	}
+}
+
+func (s *MCPServer) handleResourcesRead(req JSONRPCRequest) *JSONRPCResponse {
+	var params struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return s.errorResponse(req.ID, -32602, "Invalid params")
+	}
+
+	resource := findBrowserResource(params.URI)
+	if resource == nil {
+		return s.errorResponse(req.ID, -32002, fmt.Sprintf("Resource not found: %s", params.URI))
+	}
+
+	socketResp, errResp := s.browserRequest(req.ID, resource.Action, resource.Params)
+	if errResp != nil {
+		return errResp
+	}
+
+	jsonBytes, _ := json.MarshalIndent(socketResp.Data, "", "  ")
+	return &JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"contents": []map[string]interface{}{
+				{
+					"uri":      resource.URI,
+					"mimeType": "application/json",
+					"text":     string(jsonBytes),
+				},
+			},
+		},
+	}
+}
+
+// handleResourcesSubscribe serves resources/subscribe and resources/unsubscribe,
+// keeping the native host event subscription in step with the resources watched
+func (s *MCPServer) handleResourcesSubscribe(req JSONRPCRequest) *JSONRPCResponse {
+	var params struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return s.errorResponse(req.ID, -32602, "Invalid params")
+	}
+	if findBrowserResource(params.URI) == nil {
+		return s.errorResponse(req.ID, -32002, fmt.Sprintf("Resource not found: %s", params.URI))
+	}
+
+	subscribe := req.Method == "resources/subscribe"
+
+	s.subsMutex.Lock()
+	before := s.subscribedTopics()
+	if subscribe {
+		s.resourceSubs[params.URI] = true
+	} else {
+		delete(s.resourceSubs, params.URI)
+	}
+	after := s.subscribedTopics()
+	s.subsMutex.Unlock()
+
+	// Only tell the host about topics that actually changed
+	var added, removed []string
+	for topic := range after {
+		if !before[topic] {
+			added = append(added, topic)
+		}
+	}
+	for topic := range before {
+		if !after[topic] {
+			removed = append(removed, topic)
+		}
+	}
+	errResp := s.setEventTopics(req.ID, "subscribe", added)
+	if errResp == nil {
+		errResp = s.setEventTopics(req.ID, "unsubscribe", removed)
+	}
+	if errResp != nil && subscribe {
+		s.subsMutex.Lock()
+		delete(s.resourceSubs, params.URI)
+		s.subsMutex.Unlock()
+		return errResp
+	}
+
+	slog.Info("[MCP] Resource subscription changed", "uri", params.URI, "subscribed", subscribe)
+	return &JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result:  map[string]interface{}{},
+	}
+}
+
+// subscribedTopics returns the event topics needed for logging and the
+// subscribed resources. Callers must hold subsMutex.
+func (s *MCPServer) subscribedTopics() map[string]bool {
+	topics := make(map[string]bool)
+	for _, topic := range s.logTopics() {
+		topics[topic] = true
+	}
+	for uri := range s.resourceSubs {
+		for _, topic := range findBrowserResource(uri).Topics {
+			topics[topic] = true
+		}
+	}
+	return topics
+}
+
+// setEventTopics sends a subscribe or unsubscribe message to the native host
+func (s *MCPServer) setEventTopics(id interface{}, msgType string, topics []string) *JSONRPCResponse {
+	if len(topics) == 0 {
+		return nil
+	}
+	sort.Strings(topics)
+	_, errResp := s.socketRequest(id, SocketMessage{
+		Type:      msgType,
+		RequestId: uuid.New().String(),
+		Params:    map[string]interface{}{"topics": topics},
+		Client:    s.clientName,
+	})
+	return errResp
+}
+
+// handleBrowserEvent notifies the client about resources affected by an event
+func (s *MCPServer) handleBrowserEvent(event BrowserEvent) {
+	slog.Debug("[MCP] Browser event", "topic", event.Topic)
+	s.logBrowserEvent(event)
+
+	s.subsMutex.Lock()
+	var updated []string
+	for _, r := range browserResources {
+		if !s.resourceSubs[r.URI] {
+			continue
+		}
+		for _, topic := range r.Topics {
+			if topic == event.Topic {
+				updated = append(updated, r.URI)
+				break
+			}
+		}
+	}
+	s.subsMutex.Unlock()
+
+	for _, uri := range updated {
+		s.sendNotification("notifications/resources/updated", map[string]interface{}{
+			"uri": uri,
+		})
+	}
+}
@@ -9,26 +9,74 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// The MCP server pings the native host every SocketPingInterval and drops
+// the connection when a ping goes unanswered for SocketPingTimeout, so the
+// next tool call reconnects instead of hanging
+const (
+	SocketPingInterval = 15 * time.Second
+	SocketPingTimeout  = 5 * time.Second
+)
+
 // MCPServer implements the MCP protocol
 type MCPServer struct {
+	// socketPath is the selected browser's host socket; target is the
+	// browser chosen with select_browser (empty: the default host)
 	socketPath string
+	target     string
 	conn       net.Conn
+	artifacts  *ArtifactStore
+	clientName string // reported to the native host for auditing
+	// run_command is only offered when the user opted in
+	commandsEnabled bool
+	// reconnectGrace is how long a call waits for the native host to come
+	// back (Chrome restarts it with the extension's service worker)
+	reconnectGrace time.Duration
+
+	// Socket responses are matched to requests by requestId; events pushed
+	// by the host arrive on the same connection
+	pending   map[string]chan *SocketResponse
+	connMutex sync.Mutex
+	// Tool calls run concurrently; only one of them reconnects
+	dialMutex sync.Mutex
+
+	// Client subscriptions: resources (resources/subscribe) and the minimum
+	// level of log notifications (logging/setLevel)
+	resourceSubs map[string]bool
+	logLevel     string
+	subsMutex    sync.Mutex
+	// consoleLogs forwards page console messages as log notifications
+	consoleLogs bool
+
+	// Responses and notifications are written to stdout from different goroutines
+	writeMutex sync.Mutex
 }
 
 // NewMCPServer creates a new MCP server
-func NewMCPServer(socketPath string) *MCPServer {
+func NewMCPServer(config *Config) *MCPServer {
 	return &MCPServer{
-		socketPath: socketPath,
+		socketPath:      SocketPath,
+		target:          os.Getenv("GEMINI_BROWSER"),
+		commandsEnabled: config.Commands.Enabled,
+		reconnectGrace:  config.Bridge.QueueGrace(),
+		artifacts:       NewArtifactStore(filepath.Join(GetInstallDir(), "artifacts"), config.Artifacts.Quota()),
+		clientName:      fmt.Sprintf("mcp pid=%d", os.Getpid()),
+		pending:         make(map[string]chan *SocketResponse),
+		resourceSubs:    make(map[string]bool),
+		logLevel:        DefaultMCPLogLevel,
+		consoleLogs:     config.Logging.MCPConsole,
 	}
 }
 
@@ -52,11 +100,17 @@ type JSONRPCError struct {
 	Message string `json:"message"`
 }
 
+type JSONRPCNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
 // Run starts the MCP server main loop
 func (s *MCPServer) Run() {
 	// Connect to the Native Host socket
 	if err := s.connect(); err != nil {
-		log.Printf("[MCP] Failed to connect to native host: %v", err)
+		slog.Error("[MCP] Failed to connect to native host", "error", err)
 		// Still handle initialize - will report error on tool calls
 	}
 
@@ -66,11 +120,22 @@ func (s *MCPServer) Run() {
 
 		var req JSONRPCRequest
 		if err := json.Unmarshal(line, &req); err != nil {
-			log.Printf("[MCP] Failed to parse request: %v", err)
+			slog.Warn("[MCP] Failed to parse request", "error", err)
 			continue
 		}
 
-		log.Printf("[MCP] Received: %s", req.Method)
+		slog.Debug("[MCP] Received", "method", req.Method, "id", req.ID)
+
+		// Tool calls can take long (run_command, approvals), so they don't
+		// hold up the requests behind them
+		if req.Method == "tools/call" {
+			go func(req JSONRPCRequest) {
+				if response := s.handleRequest(req); response != nil {
+					s.sendResponse(*response)
+				}
+			}(req)
+			continue
+		}
 
 		// Handle the request
 		response := s.handleRequest(req)
@@ -84,17 +149,228 @@ func (s *MCPServer) connect() error {
 	var err error
 	maxRetries := 10
 	for i := 0; i < maxRetries; i++ {
-		s.conn, err = net.Dial("unix", s.socketPath)
-		if err == nil {
-			log.Printf("[MCP] Connected to native host socket")
+		if err = s.dial(); err == nil {
 			return nil
 		}
-		log.Printf("[MCP] Waiting for native host socket... (%d/%d)", i+1, maxRetries)
+		slog.Info("[MCP] Waiting for native host socket", "attempt", i+1, "maxRetries", maxRetries)
 		time.Sleep(500 * time.Millisecond)
 	}
 	return fmt.Errorf("failed to connect after %d retries: %w", maxRetries, err)
 }
 
+// dial opens the native host socket once and subscribes to the events
+// needed for logging and subscribed resources
+func (s *MCPServer) dial() error {
+	path, err := s.hostSocket()
+	if err != nil {
+		return err
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return err
+	}
+
+	s.connMutex.Lock()
+	s.conn = conn
+	s.socketPath = path
+	s.connMutex.Unlock()
+	go s.readSocket(conn)
+	go s.heartbeat(conn)
+	slog.Info("[MCP] Connected to native host socket", "path", path)
+
+	// Callers hold dialMutex, so subscribe on conn directly: setEventTopics
+	// goes through socketRequest, which may try to reconnect
+	s.subsMutex.Lock()
+	var topics []string
+	for topic := range s.subscribedTopics() {
+		topics = append(topics, topic)
+	}
+	s.subsMutex.Unlock()
+	if len(topics) == 0 {
+		return nil
+	}
+	sort.Strings(topics)
+	resp, err := s.exchange(conn, SocketMessage{
+		Type:      "subscribe",
+		RequestId: uuid.New().String(),
+		Params:    map[string]interface{}{"topics": topics},
+		Client:    s.clientName,
+	})
+	if err != nil {
+		s.closeConn(conn)
+		return fmt.Errorf("failed to subscribe to host events: %w", err)
+	}
+	if !resp.Success {
+		slog.Warn("[MCP] Failed to subscribe to host events", "error", resp.Error)
+	}
+	return nil
+}
+
+// reconnect makes one attempt to reopen a lost connection, e.g. after the
+// side panel was closed and reopened
+func (s *MCPServer) reconnect() {
+	s.dialMutex.Lock()
+	defer s.dialMutex.Unlock()
+	if s.connected() {
+		return
+	}
+	if err := s.dial(); err != nil {
+		slog.Debug("[MCP] Reconnect failed", "error", err)
+		return
+	}
+	s.logToClient("info", "mcp-server", "Reconnected to the Chrome native host")
+}
+
+// waitForHost reconnects to the native host, retrying for the grace window
+// so calls made while Chrome restarts it wait instead of failing. Calls
+// that were in flight when the connection dropped are not replayed: the
+// action may already have run.
+func (s *MCPServer) waitForHost() {
+	deadline := time.Now().Add(s.reconnectGrace)
+	for {
+		s.reconnect()
+		if s.connected() || !time.Now().Before(deadline) {
+			return
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// readSocket reads lines from the native host, routing responses to the
+// waiting request and events to handleBrowserEvent
+func (s *MCPServer) readSocket(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			s.disconnected(conn, err)
+			return
+		}
+
+		var envelope struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(line, &envelope); err != nil {
+			slog.Warn("[MCP] Failed to parse socket message", "error", err)
+			continue
+		}
+
+		if envelope.Type == "browser:event" {
+			var event BrowserEvent
+			if err := json.Unmarshal(line, &event); err == nil {
+				s.handleBrowserEvent(event)
+			}
+			continue
+		}
+
+		var socketResp SocketResponse
+		if err := json.Unmarshal(line, &socketResp); err != nil {
+			slog.Warn("[MCP] Failed to parse response", "error", err)
+			continue
+		}
+
+		s.connMutex.Lock()
+		respChan, ok := s.pending[socketResp.RequestId]
+		delete(s.pending, socketResp.RequestId)
+		s.connMutex.Unlock()
+
+		if ok {
+			respChan <- &socketResp
+		} else {
+			slog.Warn("[MCP] Response for unknown request", "requestId", socketResp.RequestId)
+		}
+	}
+}
+
+// heartbeat pings the native host while conn is the current connection
+func (s *MCPServer) heartbeat(conn net.Conn) {
+	ticker := time.NewTicker(SocketPingInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.connMutex.Lock()
+		current := s.conn == conn
+		s.connMutex.Unlock()
+		if !current {
+			return
+		}
+		if err := s.ping(conn); err != nil {
+			s.disconnected(conn, err)
+			return
+		}
+	}
+}
+
+// ping sends a ping on conn and waits SocketPingTimeout for the pong
+func (s *MCPServer) ping(conn net.Conn) error {
+	_, err := s.exchange(conn, SocketMessage{Type: "ping", RequestId: uuid.New().String(), Client: s.clientName})
+	return err
+}
+
+// exchange writes msg to conn, rather than the current connection, and
+// waits up to SocketPingTimeout for the reply. It never reconnects.
+func (s *MCPServer) exchange(conn net.Conn, msg SocketMessage) (*SocketResponse, error) {
+	respChan := make(chan *SocketResponse, 1)
+
+	s.connMutex.Lock()
+	s.pending[msg.RequestId] = respChan
+	data, _ := json.Marshal(msg)
+	_, err := conn.Write(append(data, '\n'))
+	s.connMutex.Unlock()
+
+	if err == nil {
+		select {
+		case resp := <-respChan:
+			if resp == nil {
+				return nil, errors.New("connection to the native host was lost")
+			}
+			return resp, nil
+		case <-time.After(SocketPingTimeout):
+			err = fmt.Errorf("native host did not answer within %v", SocketPingTimeout)
+		}
+	}
+
+	s.connMutex.Lock()
+	delete(s.pending, msg.RequestId)
+	s.connMutex.Unlock()
+	return nil, err
+}
+
+// disconnected fails every pending request after the socket closes
+func (s *MCPServer) disconnected(conn net.Conn, err error) {
+	if !s.closeConn(conn) {
+		// Already handled (the heartbeat gave up before the reader saw EOF,
+		// or another browser was selected)
+		return
+	}
+	slog.Warn("[MCP] Lost connection to native host", "error", err)
+	go s.logToClient("warning", "mcp-server", "Lost connection to the Chrome native host: "+err.Error())
+}
+
+// closeConn closes conn and, if it was the current connection, fails the
+// requests waiting on it. Reports whether it was current.
+func (s *MCPServer) closeConn(conn net.Conn) bool {
+	s.connMutex.Lock()
+	defer s.connMutex.Unlock()
+
+	conn.Close()
+	if s.conn != conn {
+		return false
+	}
+	s.conn = nil
+	for requestId, respChan := range s.pending {
+		close(respChan)
+		delete(s.pending, requestId)
+	}
+	return true
+}
+
+// connected reports whether the native host socket is open
+func (s *MCPServer) connected() bool {
+	s.connMutex.Lock()
+	defer s.connMutex.Unlock()
+	return s.conn != nil
+}
+
 func (s *MCPServer) handleRequest(req JSONRPCRequest) *JSONRPCResponse {
 	switch req.Method {
 	case "initialize":
@@ -106,6 +382,14 @@ func (s *MCPServer) handleRequest(req JSONRPCRequest) *JSONRPCResponse {
 		return s.handleToolsList(req)
 	case "tools/call":
 		return s.handleToolsCall(req)
+	case "resources/list":
+		return s.handleResourcesList(req)
+	case "resources/read":
+		return s.handleResourcesRead(req)
+	case "resources/subscribe", "resources/unsubscribe":
+		return s.handleResourcesSubscribe(req)
+	case "logging/setLevel":
+		return s.handleSetLogLevel(req)
 	default:
 		// Unknown method - ignore to avoid noise
 		return nil
@@ -113,6 +397,16 @@ func (s *MCPServer) handleRequest(req JSONRPCRequest) *JSONRPCResponse {
 }
 
 func (s *MCPServer) handleInitialize(req JSONRPCRequest) *JSONRPCResponse {
+	var params struct {
+		ClientInfo struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"clientInfo"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err == nil && params.ClientInfo.Name != "" {
+		s.clientName = fmt.Sprintf("%s %s pid=%d", params.ClientInfo.Name, params.ClientInfo.Version, os.Getpid())
+	}
+
 	return &JSONRPCResponse{
 		JSONRPC: "2.0",
 		ID:      req.ID,
@@ -120,10 +414,14 @@ func (s *MCPServer) handleInitialize(req JSONRPCRequest) *JSONRPCResponse {
 			"protocolVersion": "2024-11-05",
 			"serverInfo": map[string]string{
 				"name":    "chrome-browser-context",
-				"version": "1.0.0",
+				"version": HostVersion,
 			},
 			"capabilities": map[string]interface{}{
 				"tools": map[string]interface{}{},
+				"resources": map[string]interface{}{
+					"subscribe": true,
+				},
+				"logging": map[string]interface{}{},
 			},
 		},
 	}
@@ -162,10 +460,32 @@ func (s *MCPServer) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 		},
 		{
 			"name":        "capture_browser_screenshot",
-			"description": "Capture a screenshot of the active browser tab. Returns base64-encoded PNG.",
+			"description": "Capture a screenshot of the active browser tab (visible viewport by default). Oversized images are downscaled.",
 			"inputSchema": map[string]interface{}{
-				"type":       "object",
-				"properties": map[string]interface{}{},
+				"type": "object",
+				"properties": map[string]interface{}{
+					"fullPage": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Capture the entire scrollable page instead of the viewport",
+					},
+					"selector": map[string]interface{}{
+						"type":        "string",
+						"description": "CSS selector of an element to clip the screenshot to",
+					},
+					"format": map[string]interface{}{
+						"type":        "string",
+						"description": "Image format (default: png). Oversized webp captures are returned as jpeg",
+						"enum":        []string{"png", "jpeg", "webp"},
+					},
+					"quality": map[string]interface{}{
+						"type":        "number",
+						"description": "Compression quality 0-100 for jpeg/webp (default: 90)",
+					},
+					"maxWidth": map[string]interface{}{
+						"type":        "number",
+						"description": "Downscale images wider than this many pixels (default: 1600)",
+					},
+				},
 			},
 		},
 		{
@@ -256,6 +576,48 @@ func (s *MCPServer) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 				},
 			},
 		},
+		{
+			"name":        "get_network_requests",
+			"description": "Get network requests (XHR, fetch, documents, scripts...) captured from the active tab, with status, timing and headers. First call attaches debugger. Large bodies are saved to files.",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"urlPattern": map[string]interface{}{
+						"type":        "string",
+						"description": "Filter by URL substring, or a regex wrapped in slashes (e.g. /api\\/v[0-9]+/)",
+					},
+					"status": map[string]interface{}{
+						"type":        "string",
+						"description": "Filter by status: exact code (\"404\"), class (\"4xx\", \"5xx\") or \"failed\"",
+					},
+					"resourceType": map[string]interface{}{
+						"type":        "string",
+						"description": "Filter by resource type",
+						"enum":        []string{"XHR", "Fetch", "Document", "Script", "Stylesheet", "Image", "Font", "Media", "WebSocket", "Other"},
+					},
+					"includeBodies": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Include request and response bodies (default: false)",
+					},
+					"maxBodySize": map[string]interface{}{
+						"type":        "number",
+						"description": "Maximum characters per response body (default: 100000)",
+					},
+					"limit": map[string]interface{}{
+						"type":        "number",
+						"description": "Maximum number of requests to return, most recent first kept (default: 100)",
+					},
+				},
+			},
+		},
+		{
+			"name":        "clear_network_log",
+			"description": "Clear the captured network requests for the active tab.",
+			"inputSchema": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+		},
 		{
 			"name":        "save_page_to_file",
 			"description": "Save page content to a local file for analysis with standard tools. Use for large pages. Returns file path you can read with your file tools.",
@@ -270,11 +632,181 @@ func (s *MCPServer) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 					},
 					"filename": map[string]interface{}{
 						"type":        "string",
-						"description": "Custom filename (optional, auto-generated if not provided)",
+						"description": "Custom filename inside the pages directory, no directories (optional, auto-generated if not provided)",
+					},
+					"overwrite": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Replace an existing file with the same name (default: false)",
 					},
 				},
 			},
 		},
+		{
+			"name":        "get_action_history",
+			"description": "Review the audit log of browser actions performed by agents (newest first). Sensitive parameters such as scripts are redacted.",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"action": map[string]interface{}{
+						"type":        "string",
+						"description": "Only return entries for this action (e.g. executeScript, modifyDom)",
+					},
+					"sinceMinutes": map[string]interface{}{
+						"type":        "number",
+						"description": "Only return entries from the last N minutes",
+					},
+					"limit": map[string]interface{}{
+						"type":        "number",
+						"description": "Maximum number of entries to return (default: 50)",
+					},
+				},
+			},
+		},
+		{
+			"name":        "get_host_status",
+			"description": "Report native host health: uptime, connected clients, pending and timed-out browser requests, per-action request counts and latency, dropped terminal output and Native Messaging frame sizes.",
+			"inputSchema": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+		},
+		{
+			"name":        "list_browsers",
+			"description": "List the browsers (or Chrome profiles) running the extension, with their ids and which one tool calls go to. Only needed when more than one is open.",
+			"inputSchema": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+		},
+		{
+			"name":        "select_browser",
+			"description": "Send the following tool calls to another browser or Chrome profile from list_browsers.",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"browser": map[string]interface{}{
+						"type":        "string",
+						"description": "Id, browser name (e.g. Brave) or pid from list_browsers. Empty selects the default browser again.",
+					},
+				},
+			},
+		},
+		{
+			"name":        "get_terminal_screen",
+			"description": "Read the terminal in the Chrome side panel as the user sees it: the visible screen as plain text, the cursor position and recent scrollback. Useful for checking the output of commands run in the terminal.",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"scrollbackLines": map[string]interface{}{
+						"type":        "number",
+						"description": "Lines of scrollback above the screen to include (default: 50, max: 1000)",
+					},
+				},
+			},
+		},
+		{
+			"name":        "run_command",
+			"description": "Run a shell command on the user's machine (outside the side panel terminal) and return its output and exit code. Runs in the terminal's working directory unless cwd is given. Stdin is closed, so interactive commands fail or time out.",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"command": map[string]interface{}{
+						"type":        "string",
+						"description": "Command line to run with the user's shell (e.g. \"npm test\"), or the program to run when args is given",
+					},
+					"args": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "Arguments for command, run without a shell (optional)",
+					},
+					"cwd": map[string]interface{}{
+						"type":        "string",
+						"description": "Working directory (optional, ~ allowed)",
+					},
+					"env": map[string]interface{}{
+						"type":        "object",
+						"description": "Extra environment variables (optional)",
+					},
+					"timeoutSeconds": map[string]interface{}{
+						"type":        "number",
+						"description": "Stop the command after this many seconds (default: 120)",
+					},
+					"mode": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"pipe", "pty"},
+						"description": "pipe (default) or pty for programs that need a terminal; PTY output has colors stripped",
+					},
+					"output": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"combined", "separate"},
+						"description": "combined (default) interleaves stdout and stderr; separate returns them apart (pipe mode only)",
+					},
+				},
+				"required": []string{"command"},
+			},
+		},
+		{
+			"name":        "list_artifacts",
+			"description": "List files saved by tools with saveTo: \"file\" (screenshots, page dumps, network bodies), newest first.",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"tool": map[string]interface{}{
+						"type":        "string",
+						"description": "Only list artifacts produced by this tool",
+					},
+				},
+			},
+		},
+		{
+			"name":        "delete_artifact",
+			"description": "Delete a saved artifact by ID.",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"id": map[string]interface{}{
+						"type":        "string",
+						"description": "Artifact ID from list_artifacts",
+					},
+				},
+				"required": []string{"id"},
+			},
+		},
+	}
+
+	// Command execution is opt-in
+	if !s.commandsEnabled {
+		for i, tool := range tools {
+			if tool["name"] == "run_command" {
+				tools = append(tools[:i], tools[i+1:]...)
+				break
+			}
+		}
+	}
+
+	// Every browser tool can write its result to the artifacts directory
+	for _, tool := range tools {
+		if !savableTools[tool["name"].(string)] {
+			continue
+		}
+		schema := tool["inputSchema"].(map[string]interface{})
+		schema["properties"].(map[string]interface{})["saveTo"] = map[string]interface{}{
+			"type":        "string",
+			"description": "Set to \"file\" to save the result as an artifact and return its path instead of the content",
+			"enum":        []string{"response", "file"},
+		}
+	}
+
+	// Page readers are answered from the host's cache while the page is unchanged
+	for _, tool := range tools {
+		if !cachedTools[tool["name"].(string)] {
+			continue
+		}
+		schema := tool["inputSchema"].(map[string]interface{})
+		schema["properties"].(map[string]interface{})["noCache"] = map[string]interface{}{
+			"type":        "boolean",
+			"description": "Read the page from Chrome even if it hasn't changed since the same call (results are cached briefly)",
+		}
 	}
 
 	return &JSONRPCResponse{
@@ -286,6 +818,27 @@ func (s *MCPServer) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 	}
 }
 
+// savableTools lists the tools that accept saveTo: "file"
+var savableTools = map[string]bool{
+	"get_browser_dom":            true,
+	"get_browser_url":            true,
+	"get_browser_selection":      true,
+	"capture_browser_screenshot": true,
+	"execute_browser_script":     true,
+	"modify_dom":                 true,
+	"get_console_logs":           true,
+	"inspect_page":               true,
+	"get_page_text":              true,
+	"get_network_requests":       true,
+}
+
+// cachedTools lists the tools whose results the native host may cache
+var cachedTools = map[string]bool{
+	"get_browser_dom": true,
+	"inspect_page":    true,
+	"get_page_text":   true,
+}
+
 func (s *MCPServer) handleToolsCall(req JSONRPCRequest) *JSONRPCResponse {
 	var params struct {
 		Name      string                 `json:"name"`
@@ -295,99 +848,203 @@ func (s *MCPServer) handleToolsCall(req JSONRPCRequest) *JSONRPCResponse {
 		return s.errorResponse(req.ID, -32602, "Invalid params")
 	}
 
+	// Tools can write their result to the artifacts directory instead of returning it
+	saveTo, _ := params.Arguments["saveTo"].(string)
+	delete(params.Arguments, "saveTo")
+
+	response := s.callTool(req.ID, params.Name, params.Arguments)
+	if saveTo == "file" && savableTools[params.Name] && response.Error == nil {
+		return s.saveResultAsArtifact(req.ID, params.Name, response)
+	}
+	return response
+}
+
+func (s *MCPServer) callTool(id interface{}, name string, args map[string]interface{}) *JSONRPCResponse {
+	// Artifact management is handled locally
+	switch name {
+	case "list_artifacts":
+		tool, _ := args["tool"].(string)
+		artifacts := s.artifacts.List(tool)
+		return s.textResponse(id, map[string]interface{}{
+			"artifacts": artifacts,
+			"count":     len(artifacts),
+			"totalSize": s.artifacts.TotalSize(),
+			"directory": s.artifacts.Dir(),
+		})
+	case "delete_artifact":
+		artifactId, _ := args["id"].(string)
+		if err := s.artifacts.Delete(artifactId); err != nil {
+			return s.errorResponse(id, -32000, err.Error())
+		}
+		return s.textResponse(id, map[string]interface{}{"deleted": artifactId})
+	}
+
+	// Host health comes from the socket "status" message, not from Chrome
+	if name == "get_host_status" {
+		return s.handleHostStatus(id)
+	}
+
+	// Browsers are found in the host registry
+	switch name {
+	case "list_browsers":
+		return s.handleListBrowsers(id)
+	case "select_browser":
+		return s.handleSelectBrowser(id, args)
+	}
+
 	// Special handling for save_page_to_file - needs to write locally
-	if params.Name == "save_page_to_file" {
-		return s.handleSavePageToFile(req.ID, params.Arguments)
+	if name == "save_page_to_file" {
+		return s.handleSavePageToFile(id, args)
+	}
+
+	// Screenshots are decoded and downscaled before being returned
+	if name == "capture_browser_screenshot" {
+		return s.handleScreenshot(id, args)
+	}
+
+	// Network requests may carry large bodies that are spilled to files
+	if name == "get_network_requests" {
+		return s.handleGetNetworkRequests(id, args)
 	}
 
 	// Map tool names to Chrome actions
 	actionMap := map[string]string{
-		"get_browser_dom":            "getDom",
-		"get_browser_url":            "getUrl",
-		"get_browser_selection":      "getSelection",
-		"capture_browser_screenshot": "screenshot",
-		"execute_browser_script":     "executeScript",
-		"modify_dom":                 "modifyDom",
-		"get_console_logs":           "getConsoleLogs",
-		"inspect_page":               "inspectPage",
-		"get_page_text":              "getPageText",
-	}
-
-	action, ok := actionMap[params.Name]
+		"get_browser_dom":        "getDom",
+		"get_browser_url":        "getUrl",
+		"get_browser_selection":  "getSelection",
+		"execute_browser_script": "executeScript",
+		"modify_dom":             "modifyDom",
+		"get_console_logs":       "getConsoleLogs",
+		"inspect_page":           "inspectPage",
+		"get_page_text":          "getPageText",
+		"clear_network_log":      "clearNetworkLog",
+		"get_action_history":     "getActionHistory",
+		"get_terminal_screen":    "getTerminalScreen",
+		"run_command":            "runCommand",
+	}
+
+	action, ok := actionMap[name]
 	if !ok {
-		return s.errorResponse(req.ID, -32601, fmt.Sprintf("Unknown tool: %s", params.Name))
+		return s.errorResponse(id, -32601, fmt.Sprintf("Unknown tool: %s", name))
 	}
 
-	// Check socket connection
-	if s.conn == nil {
-		return s.errorResponse(req.ID, -32000,
-			"Not connected to Chrome. Make sure the Chrome extension is open.")
+	socketResp, errResp := s.browserRequest(id, action, args)
+	if errResp != nil {
+		return errResp
 	}
 
-	// Send request to native host via socket
+	// Format response based on tool
+	content := s.formatToolResult(name, socketResp.Data)
+
+	return &JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result: map[string]interface{}{
+			"content": content,
+		},
+	}
+}
+
+// browserRequest forwards an action to the native host and waits for its response.
+// On failure it returns a ready-to-send JSON-RPC error response instead.
+func (s *MCPServer) browserRequest(id interface{}, action string, params interface{}) (*SocketResponse, *JSONRPCResponse) {
+	// Send request to native host via socket. The same requestId is used by
+	// the socket server and the bridge, so it correlates log lines across them.
 	requestId := uuid.New().String()
-	socketReq := SocketMessage{
+	slog.Info("[MCP] Forwarding request", "action", action, "requestId", requestId)
+	return s.socketRequest(id, SocketMessage{
 		Type:      "browser:request",
 		RequestId: requestId,
 		Action:    action,
-		Params:    params.Arguments,
+		Params:    params,
+		Client:    s.clientName,
+	})
+}
+
+// socketRequest writes one message to the native host socket and waits for
+// the reply with the same requestId
+func (s *MCPServer) socketRequest(id interface{}, socketReq SocketMessage) (*SocketResponse, *JSONRPCResponse) {
+	respChan := make(chan *SocketResponse, 1)
+
+	if !s.connected() {
+		s.waitForHost()
 	}
 
+	s.connMutex.Lock()
+	if s.conn == nil {
+		s.connMutex.Unlock()
+		return nil, s.errorResponse(id, -32000,
+			"Not connected to Chrome. Make sure the Chrome extension is open.")
+	}
+	s.pending[socketReq.RequestId] = respChan
 	reqBytes, _ := json.Marshal(socketReq)
-	reqBytes = append(reqBytes, '\n')
-	if _, err := s.conn.Write(reqBytes); err != nil {
-		return s.errorResponse(req.ID, -32000, fmt.Sprintf("Failed to send request: %v", err))
+	_, err := s.conn.Write(append(reqBytes, '\n'))
+	if err != nil {
+		delete(s.pending, socketReq.RequestId)
 	}
+	s.connMutex.Unlock()
 
-	// Read response
-	reader := bufio.NewReader(s.conn)
-	respLine, err := reader.ReadBytes('\n')
 	if err != nil {
-		return s.errorResponse(req.ID, -32000, fmt.Sprintf("Failed to read response: %v", err))
+		return nil, s.errorResponse(id, -32000, fmt.Sprintf("Failed to send request: %v", err))
 	}
 
-	var socketResp SocketResponse
-	if err := json.Unmarshal(respLine, &socketResp); err != nil {
-		return s.errorResponse(req.ID, -32000, fmt.Sprintf("Failed to parse response: %v", err))
+	// Wait for the reader to route the response (nil when the connection closed)
+	socketResp := <-respChan
+	if socketResp == nil {
+		return nil, s.errorResponse(id, -32000, "Connection to the native host was lost")
 	}
 
 	if !socketResp.Success {
-		return s.errorResponse(req.ID, -32000, socketResp.Error)
+		slog.Info("[MCP] Request failed", "action", socketReq.Action, "requestId", socketReq.RequestId, "error", socketResp.Error)
+		return nil, s.errorResponse(id, -32000, socketResp.Error)
 	}
 
-	// Format response based on tool
-	content := s.formatToolResult(params.Name, socketResp.Data)
+	return socketResp, nil
+}
 
-	return &JSONRPCResponse{
-		JSONRPC: "2.0",
-		ID:      req.ID,
-		Result: map[string]interface{}{
-			"content": content,
-		},
+// handleHostStatus reports the native host metrics, or why they are unavailable
+func (s *MCPServer) handleHostStatus(id interface{}) *JSONRPCResponse {
+	if !s.connected() {
+		s.reconnect()
+	}
+	if !s.connected() {
+		return s.textResponse(id, map[string]interface{}{
+			"connected":  false,
+			"socketPath": s.currentSocket(),
+			"error":      "Not connected to the native host. Make sure the Chrome extension is open.",
+		})
+	}
+
+	socketResp, errResp := s.socketRequest(id, SocketMessage{
+		Type:      "status",
+		RequestId: uuid.New().String(),
+		Client:    s.clientName,
+	})
+	if errResp != nil {
+		return errResp
+	}
+
+	status, _ := socketResp.Data.(map[string]interface{})
+	if status == nil {
+		status = map[string]interface{}{}
 	}
+	status["connected"] = true
+	status["socketPath"] = s.currentSocket()
+	return s.textResponse(id, status)
 }
 
 func (s *MCPServer) formatToolResult(toolName string, data interface{}) []map[string]interface{} {
-	// Special handling for screenshots
-	if toolName == "capture_browser_screenshot" {
-		if dataMap, ok := data.(map[string]interface{}); ok {
-			if dataUrl, ok := dataMap["dataUrl"].(string); ok {
-				// Extract base64 data from data URL
-				if len(dataUrl) > 22 { // "data:image/png;base64,"
-					base64Data := dataUrl[22:]
-					return []map[string]interface{}{
-						{
-							"type":     "image",
-							"data":     base64Data,
-							"mimeType": "image/png",
-						},
-					}
-				}
-			}
+	// The terminal screen reads best as the text it is
+	if toolName == "get_terminal_screen" {
+		return []map[string]interface{}{
+			{
+				"type": "text",
+				"text": formatTerminalScreen(data),
+			},
 		}
 	}
 
-	// Default: return as JSON text
+	// Return as JSON text
 	jsonBytes, _ := json.MarshalIndent(data, "", "  ")
 	return []map[string]interface{}{
 		{
@@ -404,40 +1061,31 @@ func (s *MCPServer) handleSavePageToFile(id interface{}, args map[string]interfa
 		format = f
 	}
 
-	// Check socket connection
-	if s.conn == nil {
-		return s.errorResponse(id, -32000, "Not connected to Chrome. Make sure the Chrome extension is open.")
-	}
+	overwrite, _ := args["overwrite"].(bool)
 
-	// Request page content from Chrome
-	requestId := uuid.New().String()
-	socketReq := SocketMessage{
-		Type:      "browser:request",
-		RequestId: requestId,
-		Action:    "getPageForDownload",
-		Params:    map[string]interface{}{"format": format},
-	}
-
-	reqBytes, _ := json.Marshal(socketReq)
-	reqBytes = append(reqBytes, '\n')
-	if _, err := s.conn.Write(reqBytes); err != nil {
-		return s.errorResponse(id, -32000, fmt.Sprintf("Failed to send request: %v", err))
-	}
-
-	// Read response
-	reader := bufio.NewReader(s.conn)
-	respLine, err := reader.ReadBytes('\n')
-	if err != nil {
-		return s.errorResponse(id, -32000, fmt.Sprintf("Failed to read response: %v", err))
-	}
+	// Use ChromeGeminiSync directory (accessible to Gemini CLI)
+	pagesDir := filepath.Join(GetInstallDir(), "pages")
 
-	var socketResp SocketResponse
-	if err := json.Unmarshal(respLine, &socketResp); err != nil {
-		return s.errorResponse(id, -32000, fmt.Sprintf("Failed to parse response: %v", err))
+	// Validate a custom filename before touching the browser
+	var filePath string
+	switch filename := args["filename"].(type) {
+	case nil:
+	case string:
+		if filename != "" {
+			resolved, err := resolveOutputPath(pagesDir, filename)
+			if err != nil {
+				return s.errorResponse(id, -32602, fmt.Sprintf("Invalid filename: %v", err))
+			}
+			filePath = resolved
+		}
+	default:
+		return s.errorResponse(id, -32602, "Invalid filename: must be a string")
 	}
 
-	if !socketResp.Success {
-		return s.errorResponse(id, -32000, socketResp.Error)
+	// Request page content from Chrome
+	socketResp, errResp := s.browserRequest(id, "getPageForDownload", map[string]interface{}{"format": format})
+	if errResp != nil {
+		return errResp
 	}
 
 	// Extract content from response
@@ -458,61 +1106,42 @@ func (s *MCPServer) handleSavePageToFile(id interface{}, args map[string]interfa
 		ext = ".md"
 	}
 
-	// Use ChromeGeminiSync directory (accessible to Gemini CLI)
-	homeDir, _ := os.UserHomeDir()
-	pagesDir := filepath.Join(homeDir, "Library", "Application Support", "ChromeGeminiSync", "pages")
-
 	// Generate filename
-	filename := args["filename"]
-	var filePath string
-	if filename != nil && filename.(string) != "" {
-		filePath = filepath.Join(pagesDir, filename.(string))
-	} else {
+	if filePath == "" {
 		// Create a safe filename from title
-		safeTitle := "page"
-		if title != "" {
-			safeTitle = title
-			// Keep only alphanumeric and spaces, limit length
-			safe := ""
-			for _, r := range safeTitle {
-				if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == ' ' || r == '-' {
-					safe += string(r)
-				}
-			}
-			if len(safe) > 50 {
-				safe = safe[:50]
-			}
-			safeTitle = safe
-		}
+		safeTitle := sanitizeFilename(title, "page")
 		filePath = filepath.Join(pagesDir, fmt.Sprintf("%s-%d%s", safeTitle, time.Now().Unix(), ext))
 	}
 
 	// Ensure directory exists
-	os.MkdirAll(pagesDir, 0755)
-
-	// Write file
-	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+	if err := ensureOutputDir(pagesDir); err != nil {
 		return s.errorResponse(id, -32000, fmt.Sprintf("Failed to write file: %v", err))
 	}
 
-	// Get file size
-	fileInfo, _ := os.Stat(filePath)
-	fileSize := int64(0)
-	if fileInfo != nil {
-		fileSize = fileInfo.Size()
+	// Write file
+	if err := writeFileAtomic(filePath, []byte(content), overwrite); err != nil {
+		if errors.Is(err, ErrFileExists) {
+			return s.errorResponse(id, -32000, fmt.Sprintf("%s already exists. Pass overwrite: true to replace it or choose another filename.", filePath))
+		}
+		return s.errorResponse(id, -32000, fmt.Sprintf("Failed to write file: %v", err))
 	}
 
 	// Return success with file path
 	result := map[string]interface{}{
 		"filePath": filePath,
 		"format":   format,
-		"size":     fileSize,
+		"size":     len(content),
 		"url":      url,
 		"title":    title,
 		"message":  fmt.Sprintf("Page saved to %s. Use your file reading tools to analyze it.", filePath),
 	}
 
-	jsonBytes, _ := json.MarshalIndent(result, "", "  ")
+	return s.textResponse(id, result)
+}
+
+// textResponse wraps data as pretty-printed JSON text tool content
+func (s *MCPServer) textResponse(id interface{}, data interface{}) *JSONRPCResponse {
+	jsonBytes, _ := json.MarshalIndent(data, "", "  ")
 	return &JSONRPCResponse{
 		JSONRPC: "2.0",
 		ID:      id,
@@ -527,6 +1156,24 @@ func (s *MCPServer) handleSavePageToFile(id interface{}, args map[string]interfa
 	}
 }
 
+// sanitizeFilename keeps only alphanumerics, spaces and dashes, limited to 50
+// characters. Returns fallback when nothing usable remains.
+func sanitizeFilename(name, fallback string) string {
+	safe := ""
+	for _, r := range name {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == ' ' || r == '-' {
+			safe += string(r)
+		}
+	}
+	if len(safe) > 50 {
+		safe = safe[:50]
+	}
+	if safe == "" {
+		return fallback
+	}
+	return safe
+}
+
 func (s *MCPServer) errorResponse(id interface{}, code int, message string) *JSONRPCResponse {
 	return &JSONRPCResponse{
 		JSONRPC: "2.0",
@@ -541,8 +1188,26 @@ func (s *MCPServer) errorResponse(id interface{}, code int, message string) *JSO
 func (s *MCPServer) sendResponse(resp JSONRPCResponse) {
 	respBytes, err := json.Marshal(resp)
 	if err != nil {
-		log.Printf("[MCP] Failed to marshal response: %v", err)
+		slog.Error("[MCP] Failed to marshal response", "error", err)
 		return
 	}
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
 	fmt.Printf("%s\n", respBytes)
 }
+
+// sendNotification writes a JSON-RPC notification (no id, no reply expected)
+func (s *MCPServer) sendNotification(method string, params interface{}) {
+	notifBytes, err := json.Marshal(JSONRPCNotification{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		slog.Error("[MCP] Failed to marshal notification", "method", method, "error", err)
+		return
+	}
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	fmt.Printf("%s\n", notifBytes)
+}
@@ -0,0 +1,290 @@
+// Metrics
+//
+// In-process metrics registry for the native host: per-action request
+// counts and latency, bridge timeouts, dropped PTY output, connected
+// socket clients and Native Messaging frame sizes. Exposed through the
+// socket "status" message and, optionally, a localhost Prometheus
+// text endpoint.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the histogram upper bounds in seconds
+var latencyBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// MetricsConfig holds the metrics section of config.json
+type MetricsConfig struct {
+	// PrometheusAddr enables the /metrics endpoint when set (loopback only),
+	// e.g. "127.0.0.1:9464"
+	PrometheusAddr string `json:"prometheusAddr"`
+}
+
+// ActionStats aggregates requests for one action
+type ActionStats struct {
+	Count        int64   `json:"count"`
+	Errors       int64   `json:"errors"`
+	Timeouts     int64   `json:"timeouts"`
+	TotalSeconds float64 `json:"totalSeconds"`
+	MaxSeconds   float64 `json:"maxSeconds"`
+	buckets      []int64
+}
+
+// FrameStats aggregates Native Messaging frames in one direction
+type FrameStats struct {
+	Count    int64 `json:"count"`
+	Bytes    int64 `json:"bytes"`
+	MaxBytes int64 `json:"maxBytes"`
+}
+
+// Metrics is the registry
+type Metrics struct {
+	startTime       time.Time
+	actions         map[string]*ActionStats
+	droppedPTYBytes int64
+	socketClients   int64
+	frames          map[string]*FrameStats
+	gauges          map[string]func() float64
+	mutex           sync.Mutex
+}
+
+// hostMetrics is the process-wide registry
+var hostMetrics = NewMetrics()
+
+// NewMetrics creates an empty registry
+func NewMetrics() *Metrics {
+	return &Metrics{
+		startTime: time.Now(),
+		actions:   make(map[string]*ActionStats),
+		frames: map[string]*FrameStats{
+			"in":  {},
+			"out": {},
+		},
+		gauges: make(map[string]func() float64),
+	}
+}
+
+func (m *Metrics) action(name string) *ActionStats {
+	stats, ok := m.actions[name]
+	if !ok {
+		stats = &ActionStats{buckets: make([]int64, len(latencyBuckets))}
+		m.actions[name] = stats
+	}
+	return stats
+}
+
+// RecordAction records a completed request
+func (m *Metrics) RecordAction(name string, duration time.Duration, success bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stats := m.action(name)
+	seconds := duration.Seconds()
+	stats.Count++
+	if !success {
+		stats.Errors++
+	}
+	stats.TotalSeconds += seconds
+	if seconds > stats.MaxSeconds {
+		stats.MaxSeconds = seconds
+	}
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			stats.buckets[i]++
+		}
+	}
+}
+
+// RecordTimeout records a bridge request that got no reply from Chrome
+func (m *Metrics) RecordTimeout(name string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.action(name).Timeouts++
+}
+
+// AddDroppedPTYBytes records PTY output dropped because the channel was full
+func (m *Metrics) AddDroppedPTYBytes(n int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.droppedPTYBytes += int64(n)
+}
+
+// AddSocketClients adjusts the connected socket client count by delta
+func (m *Metrics) AddSocketClients(delta int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.socketClients += int64(delta)
+}
+
+// RecordFrame records a Native Messaging frame ("in" from Chrome, "out" to Chrome)
+func (m *Metrics) RecordFrame(direction string, size int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stats := m.frames[direction]
+	stats.Count++
+	stats.Bytes += int64(size)
+	if int64(size) > stats.MaxBytes {
+		stats.MaxBytes = int64(size)
+	}
+}
+
+// RegisterGauge adds a value sampled at read time (e.g. pending requests)
+func (m *Metrics) RegisterGauge(name string, fn func() float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.gauges[name] = fn
+}
+
+// Snapshot returns the current metrics as JSON-friendly data
+func (m *Metrics) Snapshot() map[string]interface{} {
+	m.mutex.Lock()
+	actions := make(map[string]ActionStats, len(m.actions))
+	for name, stats := range m.actions {
+		actions[name] = *stats
+	}
+	frames := map[string]FrameStats{
+		"in":  *m.frames["in"],
+		"out": *m.frames["out"],
+	}
+	gauges := make(map[string]func() float64, len(m.gauges))
+	for name, fn := range m.gauges {
+		gauges[name] = fn
+	}
+	snapshot := map[string]interface{}{
+		"pid":             os.Getpid(),
+		"startedAt":       m.startTime,
+		"uptimeSeconds":   int64(time.Since(m.startTime).Seconds()),
+		"actions":         actions,
+		"droppedPtyBytes": m.droppedPTYBytes,
+		"socketClients":   m.socketClients,
+		"nativeFrames":    frames,
+	}
+	m.mutex.Unlock()
+
+	// Sample gauges outside the lock: they may call into other components
+	for name, fn := range gauges {
+		snapshot[name] = fn()
+	}
+	return snapshot
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format
+func (m *Metrics) WritePrometheus(w io.Writer) {
+	m.mutex.Lock()
+	names := make([]string, 0, len(m.actions))
+	for name := range m.actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "# HELP gemini_host_requests_total Socket requests handled, by action and outcome.")
+	fmt.Fprintln(w, "# TYPE gemini_host_requests_total counter")
+	for _, name := range names {
+		stats := m.actions[name]
+		fmt.Fprintf(w, "gemini_host_requests_total{action=%q,outcome=\"success\"} %d\n", name, stats.Count-stats.Errors)
+		fmt.Fprintf(w, "gemini_host_requests_total{action=%q,outcome=\"error\"} %d\n", name, stats.Errors)
+	}
+
+	fmt.Fprintln(w, "# HELP gemini_host_request_duration_seconds Socket request latency.")
+	fmt.Fprintln(w, "# TYPE gemini_host_request_duration_seconds histogram")
+	for _, name := range names {
+		stats := m.actions[name]
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(w, "gemini_host_request_duration_seconds_bucket{action=%q,le=\"%g\"} %d\n", name, bound, stats.buckets[i])
+		}
+		fmt.Fprintf(w, "gemini_host_request_duration_seconds_bucket{action=%q,le=\"+Inf\"} %d\n", name, stats.Count)
+		fmt.Fprintf(w, "gemini_host_request_duration_seconds_sum{action=%q} %g\n", name, stats.TotalSeconds)
+		fmt.Fprintf(w, "gemini_host_request_duration_seconds_count{action=%q} %d\n", name, stats.Count)
+	}
+
+	fmt.Fprintln(w, "# HELP gemini_host_request_timeouts_total Bridge requests that Chrome did not answer in time.")
+	fmt.Fprintln(w, "# TYPE gemini_host_request_timeouts_total counter")
+	for _, name := range names {
+		fmt.Fprintf(w, "gemini_host_request_timeouts_total{action=%q} %d\n", name, m.actions[name].Timeouts)
+	}
+
+	fmt.Fprintln(w, "# HELP gemini_host_pty_dropped_bytes_total PTY output dropped because the output channel was full.")
+	fmt.Fprintln(w, "# TYPE gemini_host_pty_dropped_bytes_total counter")
+	fmt.Fprintf(w, "gemini_host_pty_dropped_bytes_total %d\n", m.droppedPTYBytes)
+
+	fmt.Fprintln(w, "# HELP gemini_host_socket_clients Connected MCP socket clients.")
+	fmt.Fprintln(w, "# TYPE gemini_host_socket_clients gauge")
+	fmt.Fprintf(w, "gemini_host_socket_clients %d\n", m.socketClients)
+
+	fmt.Fprintln(w, "# HELP gemini_host_native_frames_total Native Messaging frames, by direction.")
+	fmt.Fprintln(w, "# TYPE gemini_host_native_frames_total counter")
+	for _, dir := range []string{"in", "out"} {
+		fmt.Fprintf(w, "gemini_host_native_frames_total{direction=%q} %d\n", dir, m.frames[dir].Count)
+	}
+	fmt.Fprintln(w, "# HELP gemini_host_native_frame_bytes_total Native Messaging bytes, by direction.")
+	fmt.Fprintln(w, "# TYPE gemini_host_native_frame_bytes_total counter")
+	for _, dir := range []string{"in", "out"} {
+		fmt.Fprintf(w, "gemini_host_native_frame_bytes_total{direction=%q} %d\n", dir, m.frames[dir].Bytes)
+	}
+	fmt.Fprintln(w, "# HELP gemini_host_native_frame_max_bytes Largest Native Messaging frame seen, by direction.")
+	fmt.Fprintln(w, "# TYPE gemini_host_native_frame_max_bytes gauge")
+	for _, dir := range []string{"in", "out"} {
+		fmt.Fprintf(w, "gemini_host_native_frame_max_bytes{direction=%q} %d\n", dir, m.frames[dir].MaxBytes)
+	}
+
+	gaugeNames := make([]string, 0, len(m.gauges))
+	for name := range m.gauges {
+		gaugeNames = append(gaugeNames, name)
+	}
+	sort.Strings(gaugeNames)
+	gauges := make(map[string]func() float64, len(m.gauges))
+	for name, fn := range m.gauges {
+		gauges[name] = fn
+	}
+	uptime := time.Since(m.startTime).Seconds()
+	m.mutex.Unlock()
+
+	fmt.Fprintln(w, "# TYPE gemini_host_uptime_seconds gauge")
+	fmt.Fprintf(w, "gemini_host_uptime_seconds %g\n", uptime)
+	for _, name := range gaugeNames {
+		fmt.Fprintf(w, "# TYPE gemini_host_%s gauge\n", name)
+		fmt.Fprintf(w, "gemini_host_%s %g\n", name, gauges[name]())
+	}
+}
+
+// StartPrometheus serves /metrics on addr. Only loopback addresses are
+// accepted since the endpoint is unauthenticated.
+func (m *Metrics) StartPrometheus(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid metrics address %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("metrics address must be loopback, got %q", addr)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		m.WritePrometheus(w)
+	})
+
+	slog.Info("[Metrics] Serving Prometheus metrics", "addr", listener.Addr().String())
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			slog.Error("[Metrics] Server stopped", "error", err)
+		}
+	}()
+	return nil
+}
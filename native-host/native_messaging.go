@@ -3,7 +3,9 @@
 // Chrome's Native Messaging uses a simple protocol:
 // - Messages are JSON
 // - Each message is prefixed with a 4-byte little-endian length
-// - Max message size is 1MB (1024*1024 bytes)
+// - Max message size from the host is 1MB (1024*1024 bytes)
+// - Messages from Chrome may be much larger (up to 64MB here), which
+//   full-page screenshots and page downloads rely on
 
 package main
 
@@ -12,33 +14,32 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sync"
 )
 
 const MaxMessageSize = 1024 * 1024 // 1MB
 
-// Message represents a Native Messaging message
-type Message struct {
-	Type      string      `json:"type"`
-	Data      interface{} `json:"data,omitempty"`
-	Cols      interface{} `json:"cols,omitempty"`
-	Rows      interface{} `json:"rows,omitempty"`
-	RequestId interface{} `json:"requestId,omitempty"`
-	Action    string      `json:"action,omitempty"`
-	Params    interface{} `json:"params,omitempty"`
-	Success   bool        `json:"success,omitempty"`
-	Error     string      `json:"error,omitempty"`
-}
+// MaxIncomingMessageSize bounds messages read from Chrome. It is Chrome's
+// own limit for messages to a native host: a full-page screenshot or page
+// download arrives as a single base64 frame, which easily exceeds 1MB.
+const MaxIncomingMessageSize = 64 * 1024 * 1024 // 64MB
+
+// writeMutex serializes writes to Chrome: PTY output, bridge requests and
+// replies are sent from different goroutines and frames must not interleave
+var writeMutex sync.Mutex
 
-// ReadNativeMessage reads a length-prefixed JSON message from the reader
-func ReadNativeMessage(r io.Reader) (*Message, error) {
+// ReadNativeMessage reads a length-prefixed JSON message from the reader.
+// The frame is returned undecoded; DecodeMessage turns it into a typed
+// message.
+func ReadNativeMessage(r io.Reader) (json.RawMessage, error) {
 	// Read 4-byte length prefix (little-endian)
 	var length uint32
 	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
 		return nil, fmt.Errorf("failed to read message length: %w", err)
 	}
 
-	if length > MaxMessageSize {
-		return nil, fmt.Errorf("message too large: %d bytes (max %d)", length, MaxMessageSize)
+	if length > MaxIncomingMessageSize {
+		return nil, fmt.Errorf("message too large: %d bytes (max %d)", length, MaxIncomingMessageSize)
 	}
 
 	// Read the JSON message
@@ -46,18 +47,13 @@ func ReadNativeMessage(r io.Reader) (*Message, error) {
 	if _, err := io.ReadFull(r, msgBytes); err != nil {
 		return nil, fmt.Errorf("failed to read message body: %w", err)
 	}
+	hostMetrics.RecordFrame("in", int(length))
 
-	// Parse JSON
-	var msg Message
-	if err := json.Unmarshal(msgBytes, &msg); err != nil {
-		return nil, fmt.Errorf("failed to parse message JSON: %w", err)
-	}
-
-	return &msg, nil
+	return json.RawMessage(msgBytes), nil
 }
 
 // WriteNativeMessage writes a length-prefixed JSON message to the writer
-func WriteNativeMessage(w io.Writer, msg Message) error {
+func WriteNativeMessage(w io.Writer, msg interface{}) error {
 	// Serialize to JSON
 	msgBytes, err := json.Marshal(msg)
 	if err != nil {
@@ -68,6 +64,9 @@ func WriteNativeMessage(w io.Writer, msg Message) error {
 		return fmt.Errorf("message too large: %d bytes (max %d)", len(msgBytes), MaxMessageSize)
 	}
 
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
 	// Write 4-byte length prefix (little-endian)
 	length := uint32(len(msgBytes))
 	if err := binary.Write(w, binary.LittleEndian, length); err != nil {
@@ -78,23 +77,7 @@ func WriteNativeMessage(w io.Writer, msg Message) error {
 	if _, err := w.Write(msgBytes); err != nil {
 		return fmt.Errorf("failed to write message body: %w", err)
 	}
+	hostMetrics.RecordFrame("out", len(msgBytes))
 
 	return nil
 }
-
-// BrowserRequest represents a request to be sent to Chrome
-type BrowserRequest struct {
-	Type      string      `json:"type"`
-	Action    string      `json:"action"`
-	Params    interface{} `json:"params,omitempty"`
-	RequestId string      `json:"requestId"`
-}
-
-// BrowserResponse represents a response from Chrome
-type BrowserResponse struct {
-	Type      string      `json:"type"`
-	RequestId string      `json:"requestId"`
-	Success   bool        `json:"success"`
-	Data      interface{} `json:"data,omitempty"`
-	Error     string      `json:"error,omitempty"`
-}
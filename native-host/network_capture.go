@@ -0,0 +1,100 @@
+// Network Capture
+//
+// Post-processes network requests captured by the Chrome extension's
+// debugger attachment. Request and response bodies above a small inline
+// limit are spilled to the artifact store so tool results stay compact.
+
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// InlineBodyLimit is the largest body (in bytes) returned inline in a tool result
+const InlineBodyLimit = 4 * 1024
+
+func (s *MCPServer) handleGetNetworkRequests(id interface{}, args map[string]interface{}) *JSONRPCResponse {
+	socketResp, errResp := s.browserRequest(id, "getNetworkRequests", args)
+	if errResp != nil {
+		return errResp
+	}
+
+	dataMap, ok := socketResp.Data.(map[string]interface{})
+	if !ok {
+		return s.errorResponse(id, -32000, "Invalid response format")
+	}
+
+	pageURL, _ := dataMap["url"].(string)
+	meta := Artifact{Tool: "get_network_requests", URL: pageURL}
+	requests, _ := dataMap["requests"].([]interface{})
+	spilled := 0
+	for _, r := range requests {
+		entry, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, field := range []string{"requestBody", "responseBody"} {
+			saved, err := s.spillBody(entry, field, meta)
+			if err != nil {
+				slog.Error("[MCP] Failed to save body", "field", field, "error", err)
+				delete(entry, field)
+				entry[field+"Error"] = err.Error()
+				continue
+			}
+			if saved {
+				spilled++
+			}
+		}
+	}
+
+	if spilled > 0 {
+		dataMap["message"] = fmt.Sprintf("%d large bodies saved to %s. Use your file reading tools to analyze them.", spilled, s.artifacts.Dir())
+	}
+
+	return s.textResponse(id, dataMap)
+}
+
+// spillBody stores entry[field] as an artifact when it exceeds InlineBodyLimit
+// and replaces it with <field>File and <field>Size. Bodies prefixed with
+// "base64:" are decoded and stored as raw bytes. The artifact is marked
+// truncated when <field>Truncated is set.
+func (s *MCPServer) spillBody(entry map[string]interface{}, field string, meta Artifact) (bool, error) {
+	body, ok := entry[field].(string)
+	if !ok || len(body) <= InlineBodyLimit {
+		return false, nil
+	}
+	meta.Truncated, _ = entry[field+"Truncated"].(bool)
+
+	content := []byte(body)
+	ext, mimeType := ".txt", "text/plain"
+	if encoded, found := strings.CutPrefix(body, "base64:"); found {
+		decoded, err := decodeTruncatedBase64(encoded)
+		if err != nil {
+			return false, fmt.Errorf("invalid base64 body: %w", err)
+		}
+		content = decoded
+		ext, mimeType = ".bin", "application/octet-stream"
+	}
+
+	artifact, err := s.artifacts.Save(content, ext, mimeType, meta)
+	if err != nil {
+		return false, err
+	}
+
+	delete(entry, field)
+	entry[field+"File"] = artifact.Path
+	entry[field+"Size"] = artifact.Size
+	return true, nil
+}
+
+// decodeTruncatedBase64 decodes standard base64 that may have been cut at any
+// length, dropping a trailing partial group
+func decodeTruncatedBase64(encoded string) ([]byte, error) {
+	if partial := len(encoded) % 4; partial != 0 {
+		encoded = encoded[:len(encoded)-partial]
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSpillBody(t *testing.T) {
+	raw := bytes.Repeat([]byte{0xff, 0x00, 0x7f}, InlineBodyLimit)
+	encoded := base64.StdEncoding.EncodeToString(raw)
+
+	tests := []struct {
+		name          string
+		body          string
+		truncated     bool
+		wantContent   []byte
+		wantTruncated bool
+		wantErr       bool
+	}{
+		{name: "text", body: strings.Repeat("a", InlineBodyLimit+1), wantContent: []byte(strings.Repeat("a", InlineBodyLimit+1))},
+		{name: "base64", body: "base64:" + encoded, wantContent: raw},
+		{
+			// Older extensions cut base64 at any length
+			name: "base64 cut mid-group", body: "base64:" + encoded[:len(encoded)-2], truncated: true,
+			wantContent: raw[:len(raw)-3], wantTruncated: true,
+		},
+		{name: "invalid base64", body: "base64:" + strings.Repeat("!", InlineBodyLimit), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &MCPServer{artifacts: NewArtifactStore(t.TempDir(), 1<<30)}
+			entry := map[string]interface{}{"responseBody": tt.body, "responseBodyTruncated": tt.truncated}
+
+			saved, err := s.spillBody(entry, "responseBody", Artifact{Tool: "get_network_requests"})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				return
+			}
+			if err != nil || !saved {
+				t.Fatalf("spillBody() = %v, %v", saved, err)
+			}
+
+			path, _ := entry["responseBodyFile"].(string)
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(content, tt.wantContent) {
+				t.Errorf("saved %d bytes, want %d", len(content), len(tt.wantContent))
+			}
+			if list := s.artifacts.List(""); len(list) != 1 || list[0].Truncated != tt.wantTruncated {
+				t.Errorf("artifacts = %+v, want one with truncated %v", list, tt.wantTruncated)
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+// Policy Engine
+//
+// Decides whether an action requested by an MCP client may run.
+// Rules combine per-action decisions, origin allow/deny lists, per-origin
+// overrides and a read-only mode. Actions marked "ask" are sent to the
+// side panel for interactive approval; answers the user chooses to
+// remember are cached per origin for the rest of the session. Mutating
+// actions are pinned to the tab that was checked, so the extension can
+// refuse them if that tab has since moved to another origin.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Policy decisions
+const (
+	PolicyAllow = "allow"
+	PolicyDeny  = "deny"
+	PolicyAsk   = "ask"
+)
+
+// mutatingActions change page or machine state and are blocked in
+// read-only mode
+var mutatingActions = map[string]bool{
+	"executeScript": true,
+	"modifyDom":     true,
+	"runCommand":    true,
+}
+
+// localOrigin stands in for the origin of actions the native host serves
+// itself, in approval prompts and remembered decisions
+const localOrigin = "this computer"
+
+// PolicyConfig holds the policy rules from config.json
+type PolicyConfig struct {
+	// ReadOnly denies every mutating action regardless of other rules
+	ReadOnly bool `json:"readOnly"`
+	// Actions maps an action name to allow, deny or ask (default: allow)
+	Actions map[string]string `json:"actions"`
+	// AllowOrigins, when non-empty, restricts all actions to these origins
+	AllowOrigins []string `json:"allowOrigins"`
+	// DenyOrigins blocks all actions on these origins
+	DenyOrigins []string `json:"denyOrigins"`
+	// Origins overrides action decisions per origin pattern
+	Origins map[string]map[string]string `json:"origins"`
+}
+
+// DefaultPolicyConfig asks before running scripts, modifying pages or
+// running commands
+func DefaultPolicyConfig() PolicyConfig {
+	return PolicyConfig{
+		Actions: map[string]string{
+			"executeScript": PolicyAsk,
+			"modifyDom":     PolicyAsk,
+			"runCommand":    PolicyAsk,
+		},
+	}
+}
+
+// policyBridge is what the policy engine needs from Chrome
+type policyBridge interface {
+	ActiveTab() (PolicyTarget, error)
+	RequestApproval(action string, details interface{}) (*BrowserResponse, error)
+}
+
+// PolicyEngine evaluates socket requests against the configured rules
+type PolicyEngine struct {
+	config    PolicyConfig
+	bridge    policyBridge
+	decisions map[string]bool // "origin|action" -> approved
+	// prompts holds the approval prompt open per "origin|action", so
+	// concurrent requests don't each open their own
+	prompts map[string]*approvalPrompt
+	mutex   sync.Mutex
+}
+
+// approvalPrompt is an approval the side panel is showing
+type approvalPrompt struct {
+	summary string
+	done    chan struct{}
+	err     error // set before done is closed
+}
+
+// PolicyTarget is the tab a request was checked against. TabId is 0 when
+// no rule needed the active tab.
+type PolicyTarget struct {
+	TabId int
+	URL   string
+	Title string
+}
+
+// Pin returns params with the checked tab added, so the extension runs the
+// action on that tab and refuses it if the tab left the checked origin
+func (t PolicyTarget) Pin(params interface{}) interface{} {
+	if t.TabId == 0 {
+		return params
+	}
+	p, _ := params.(map[string]interface{})
+	pinned := make(map[string]interface{}, len(p)+2)
+	for k, v := range p {
+		pinned[k] = v
+	}
+	pinned["targetTabId"] = t.TabId
+	pinned["targetUrl"] = t.URL
+	return pinned
+}
+
+// pinnedTarget returns the tab Pin added to params, if any
+func pinnedTarget(params interface{}) PolicyTarget {
+	p, _ := params.(map[string]interface{})
+	var target PolicyTarget
+	switch id := p["targetTabId"].(type) {
+	case int:
+		target.TabId = id
+	case float64:
+		target.TabId = int(id)
+	}
+	target.URL, _ = p["targetUrl"].(string)
+	return target
+}
+
+// NewPolicyEngine creates a policy engine
+func NewPolicyEngine(config PolicyConfig, bridge policyBridge) *PolicyEngine {
+	return &PolicyEngine{
+		config:    config,
+		bridge:    bridge,
+		decisions: make(map[string]bool),
+		prompts:   make(map[string]*approvalPrompt),
+	}
+}
+
+// Check returns an error if the request must not be forwarded to Chrome,
+// along with the tab it was checked against
+func (p *PolicyEngine) Check(msg SocketMessage) (PolicyTarget, error) {
+	action := msg.Action
+
+	if p.config.ReadOnly && mutatingActions[action] {
+		return PolicyTarget{}, fmt.Errorf("blocked by policy: %s is not allowed in read-only mode", action)
+	}
+
+	// A denied action can still be allowed for some origins
+	decision := p.actionDecision(action)
+	if decision == PolicyDeny && !p.hasOriginOverride(action) {
+		return PolicyTarget{}, fmt.Errorf("blocked by policy: %s is denied", action)
+	}
+
+	// Only look up the active tab when a rule depends on it or the action
+	// must be pinned to it
+	if decision == PolicyAllow && !p.hasOriginRules() && !mutatingActions[action] {
+		return PolicyTarget{}, nil
+	}
+
+	target, err := p.activeTab()
+	if err != nil {
+		return PolicyTarget{}, fmt.Errorf("blocked by policy: cannot determine active tab origin: %v", err)
+	}
+	origin := originOf(target.URL)
+
+	for _, pattern := range p.config.DenyOrigins {
+		if matchOrigin(pattern, origin) {
+			return target, fmt.Errorf("blocked by policy: %s is denied on %s", action, origin)
+		}
+	}
+	if len(p.config.AllowOrigins) > 0 && !p.originAllowed(origin) {
+		return target, fmt.Errorf("blocked by policy: %s is not in the allowed origins", origin)
+	}
+
+	// The most specific (longest) matching origin pattern wins
+	best := -1
+	for pattern, actions := range p.config.Origins {
+		if d, ok := actions[action]; ok && len(pattern) > best && matchOrigin(pattern, origin) {
+			decision = d
+			best = len(pattern)
+		}
+	}
+
+	switch decision {
+	case PolicyAllow:
+		return target, nil
+	case PolicyAsk:
+		return target, p.askApproval(msg, origin, target)
+	default:
+		return target, fmt.Errorf("blocked by policy: %s is denied on %s", action, origin)
+	}
+}
+
+// CheckLocal returns an error if an action the native host serves itself
+// must not run. Such actions don't touch a page, so origin rules don't
+// apply; read-only mode and the action's decision do.
+func (p *PolicyEngine) CheckLocal(msg SocketMessage) error {
+	action := msg.Action
+
+	if p.config.ReadOnly && mutatingActions[action] {
+		return fmt.Errorf("blocked by policy: %s is not allowed in read-only mode", action)
+	}
+
+	switch p.actionDecision(action) {
+	case PolicyAllow:
+		return nil
+	case PolicyAsk:
+		return p.askApproval(msg, localOrigin, PolicyTarget{})
+	default:
+		return fmt.Errorf("blocked by policy: %s is denied", action)
+	}
+}
+
+func (p *PolicyEngine) actionDecision(action string) string {
+	if d, ok := p.config.Actions[action]; ok {
+		return d
+	}
+	return PolicyAllow
+}
+
+func (p *PolicyEngine) hasOriginRules() bool {
+	return len(p.config.AllowOrigins) > 0 || len(p.config.DenyOrigins) > 0 || len(p.config.Origins) > 0
+}
+
+func (p *PolicyEngine) hasOriginOverride(action string) bool {
+	for _, actions := range p.config.Origins {
+		if _, ok := actions[action]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *PolicyEngine) originAllowed(origin string) bool {
+	for _, pattern := range p.config.AllowOrigins {
+		if matchOrigin(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *PolicyEngine) activeTab() (PolicyTarget, error) {
+	return p.bridge.ActiveTab()
+}
+
+// askApproval prompts the user unless a remembered decision exists for the
+// origin. A request arriving while the same action is being asked about
+// for the origin waits for that answer: it shares it when it would have
+// shown the same prompt, otherwise it asks in turn.
+func (p *PolicyEngine) askApproval(msg SocketMessage, origin string, target PolicyTarget) error {
+	key := origin + "|" + msg.Action
+	summary := summarizeParams(msg.Action, msg.Params)
+
+	for {
+		p.mutex.Lock()
+		approved, cached := p.decisions[key]
+		prompt, asking := p.prompts[key]
+		if !cached && !asking {
+			prompt = &approvalPrompt{summary: summary, done: make(chan struct{})}
+			p.prompts[key] = prompt
+		}
+		p.mutex.Unlock()
+
+		switch {
+		case cached && approved:
+			return nil
+		case cached:
+			return fmt.Errorf("blocked by policy: %s was denied for %s this session", msg.Action, origin)
+		case asking:
+			<-prompt.done
+			if prompt.summary == summary {
+				return prompt.err
+			}
+			continue
+		}
+
+		prompt.err = p.promptUser(msg, key, origin, target, summary)
+		p.mutex.Lock()
+		delete(p.prompts, key)
+		p.mutex.Unlock()
+		close(prompt.done)
+		return prompt.err
+	}
+}
+
+// promptUser shows the approval prompt in the side panel
+func (p *PolicyEngine) promptUser(msg SocketMessage, key, origin string, target PolicyTarget, summary string) error {
+	resp, err := p.bridge.RequestApproval(msg.Action, map[string]interface{}{
+		"origin":  origin,
+		"url":     target.URL,
+		"title":   target.Title,
+		"summary": summary,
+	})
+	if err != nil {
+		return fmt.Errorf("approval not received: %v", err)
+	}
+
+	data, _ := resp.Data.(map[string]interface{})
+	if remember, _ := data["remember"].(bool); remember {
+		p.mutex.Lock()
+		p.decisions[key] = resp.Success
+		p.mutex.Unlock()
+	}
+
+	slog.Info("[Policy] Approval decision", "action", msg.Action, "origin", origin, "approved", resp.Success, "requestId", msg.RequestId)
+	if !resp.Success {
+		return fmt.Errorf("denied by user: %s on %s", msg.Action, origin)
+	}
+	return nil
+}
+
+// summarizeParams describes an action for the approval prompt
+func summarizeParams(action string, params interface{}) string {
+	p, _ := params.(map[string]interface{})
+	switch action {
+	case "executeScript":
+		script, _ := p["script"].(string)
+		if len(script) > 500 {
+			script = script[:500] + "..."
+		}
+		return script
+	case "modifyDom":
+		return fmt.Sprintf("%v on %v", p["action"], p["selector"])
+	case "runCommand":
+		command, _ := p["command"].(string)
+		if cwd, _ := p["cwd"].(string); cwd != "" {
+			return command + " (in " + cwd + ")"
+		}
+		return command
+	default:
+		return action
+	}
+}
+
+// originOf returns scheme://host[:port] for a URL
+func originOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// matchOrigin matches an origin against a pattern. Patterns are either a full
+// origin ("https://example.com"), a host ("example.com") or a wildcard host
+// ("*.example.com", which also matches example.com itself).
+func matchOrigin(pattern, origin string) bool {
+	if pattern == "*" || pattern == origin {
+		return true
+	}
+
+	host := origin
+	if u, err := url.Parse(origin); err == nil && u.Host != "" {
+		host = u.Hostname()
+	}
+
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return host == suffix || strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
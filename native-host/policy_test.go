@@ -0,0 +1,386 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBridge stands in for Chrome: a fixed active tab and scripted answers
+// to approval prompts
+type fakeBridge struct {
+	tab      PolicyTarget
+	tabErr   error
+	approve  bool
+	remember bool
+	// release, when set, holds each prompt open until it receives a value
+	release chan struct{}
+
+	mutex   sync.Mutex
+	prompts []string // summaries, in the order the prompts were shown
+}
+
+func (f *fakeBridge) ActiveTab() (PolicyTarget, error) {
+	return f.tab, f.tabErr
+}
+
+func (f *fakeBridge) RequestApproval(action string, details interface{}) (*BrowserResponse, error) {
+	d := details.(map[string]interface{})
+	f.mutex.Lock()
+	f.prompts = append(f.prompts, d["summary"].(string))
+	f.mutex.Unlock()
+	if f.release != nil {
+		<-f.release
+	}
+	return &BrowserResponse{
+		Success: f.approve,
+		Data:    map[string]interface{}{"remember": f.remember},
+	}, nil
+}
+
+func (f *fakeBridge) promptCount() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.prompts)
+}
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		pattern, origin string
+		want            bool
+	}{
+		{"*", "https://anything.example", true},
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "http://example.com", false},
+		{"http://localhost:3000", "http://localhost:3000", true},
+		{"http://localhost:3000", "http://localhost:3001", false},
+		{"localhost", "http://localhost:3000", true},
+		{"example.com", "https://example.com", true},
+		{"example.com", "https://www.example.com", false},
+		{"example.com", "https://example.com.evil.net", false},
+		{"*.example.com", "https://example.com", true},
+		{"*.example.com", "https://a.b.example.com:8443", true},
+		{"*.example.com", "https://notexample.com", false},
+		{"*.example.com", "https://example.com.evil.net", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.origin, func(t *testing.T) {
+			if got := matchOrigin(tt.pattern, tt.origin); got != tt.want {
+				t.Errorf("matchOrigin(%q, %q) = %v, want %v", tt.pattern, tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	tab := PolicyTarget{TabId: 7, URL: "https://app.example.com/page", Title: "App"}
+
+	tests := []struct {
+		name    string
+		config  PolicyConfig
+		action  string
+		tabErr  error
+		approve bool
+		wantErr bool
+		// wantPrompts is how many approval prompts were shown
+		wantPrompts int
+		// wantTabId is the tab the request is pinned to (0: not pinned)
+		wantTabId int
+	}{
+		{name: "reads allowed by default", action: "getPageText"},
+		{name: "mutating actions are pinned", action: "modifyDom", wantTabId: 7},
+		{
+			name:    "read-only blocks mutating actions",
+			config:  PolicyConfig{ReadOnly: true, Actions: map[string]string{"executeScript": PolicyAllow}},
+			action:  "executeScript",
+			wantErr: true,
+		},
+		{
+			name:   "read-only allows reads",
+			config: PolicyConfig{ReadOnly: true},
+			action: "getDom",
+		},
+		{
+			name:    "denied action",
+			config:  PolicyConfig{Actions: map[string]string{"screenshot": PolicyDeny}},
+			action:  "screenshot",
+			wantErr: true,
+		},
+		{
+			name:    "denied origin",
+			config:  PolicyConfig{DenyOrigins: []string{"*.example.com"}},
+			action:  "getPageText",
+			wantErr: true,
+		},
+		{
+			name: "deny wins over allow",
+			config: PolicyConfig{
+				AllowOrigins: []string{"app.example.com"},
+				DenyOrigins:  []string{"*.example.com"},
+			},
+			action:  "getPageText",
+			wantErr: true,
+		},
+		{
+			name:      "allowed origin",
+			config:    PolicyConfig{AllowOrigins: []string{"other.com", "app.example.com"}},
+			action:    "getPageText",
+			wantTabId: 7,
+		},
+		{
+			name:    "origin outside the allow list",
+			config:  PolicyConfig{AllowOrigins: []string{"other.com"}},
+			action:  "getPageText",
+			wantErr: true,
+		},
+		{
+			name:    "active tab unknown",
+			config:  PolicyConfig{AllowOrigins: []string{"*"}},
+			action:  "getPageText",
+			tabErr:  fmt.Errorf("no active tab"),
+			wantErr: true,
+		},
+		{
+			name: "longest origin pattern wins",
+			config: PolicyConfig{
+				Actions: map[string]string{"executeScript": PolicyDeny},
+				Origins: map[string]map[string]string{
+					"*":                       {"executeScript": PolicyDeny},
+					"*.example.com":           {"executeScript": PolicyDeny},
+					"https://app.example.com": {"executeScript": PolicyAllow},
+				},
+			},
+			action:    "executeScript",
+			wantTabId: 7,
+		},
+		{
+			name: "shorter pattern loses even when listed alone for the action",
+			config: PolicyConfig{
+				Origins: map[string]map[string]string{
+					"*.example.com":   {"modifyDom": PolicyAllow},
+					"app.example.com": {"modifyDom": PolicyDeny},
+				},
+			},
+			action:  "modifyDom",
+			wantErr: true,
+		},
+		{
+			name: "origin override allows a denied action",
+			config: PolicyConfig{
+				Actions: map[string]string{"getDom": PolicyDeny},
+				Origins: map[string]map[string]string{"app.example.com": {"getDom": PolicyAllow}},
+			},
+			action:    "getDom",
+			wantTabId: 7,
+		},
+		{
+			name: "denied action stays denied elsewhere",
+			config: PolicyConfig{
+				Actions: map[string]string{"getDom": PolicyDeny},
+				Origins: map[string]map[string]string{"other.com": {"getDom": PolicyAllow}},
+			},
+			action:  "getDom",
+			wantErr: true,
+		},
+		{
+			name: "override for another action doesn't apply",
+			config: PolicyConfig{
+				Actions: map[string]string{"executeScript": PolicyDeny},
+				Origins: map[string]map[string]string{
+					"app.example.com": {"modifyDom": PolicyAllow},
+				},
+			},
+			action:  "executeScript",
+			wantErr: true,
+		},
+		{
+			name:        "ask and approved",
+			config:      DefaultPolicyConfig(),
+			action:      "executeScript",
+			approve:     true,
+			wantPrompts: 1,
+			wantTabId:   7,
+		},
+		{
+			name:        "ask and denied",
+			config:      DefaultPolicyConfig(),
+			action:      "modifyDom",
+			wantErr:     true,
+			wantPrompts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bridge := &fakeBridge{tab: tab, tabErr: tt.tabErr, approve: tt.approve}
+			policy := NewPolicyEngine(tt.config, bridge)
+
+			target, err := policy.Check(SocketMessage{Action: tt.action, Params: map[string]interface{}{}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check(%s) = %v, wantErr %v", tt.action, err, tt.wantErr)
+			}
+			if got := bridge.promptCount(); got != tt.wantPrompts {
+				t.Errorf("%d prompts, want %d", got, tt.wantPrompts)
+			}
+			if err == nil && target.TabId != tt.wantTabId {
+				t.Errorf("pinned to tab %d, want %d", target.TabId, tt.wantTabId)
+			}
+		})
+	}
+}
+
+func TestPolicyRemembersDecision(t *testing.T) {
+	bridge := &fakeBridge{tab: PolicyTarget{TabId: 1, URL: "https://a.com/"}, approve: true, remember: true}
+	policy := NewPolicyEngine(DefaultPolicyConfig(), bridge)
+	msg := SocketMessage{Action: "executeScript", Params: map[string]interface{}{"script": "1"}}
+
+	for i := 0; i < 3; i++ {
+		if _, err := policy.Check(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := bridge.promptCount(); got != 1 {
+		t.Errorf("%d prompts, want 1", got)
+	}
+
+	// Remembered per origin
+	bridge.tab = PolicyTarget{TabId: 2, URL: "https://b.com/"}
+	policy.Check(msg)
+	if got := bridge.promptCount(); got != 2 {
+		t.Errorf("%d prompts after switching origin, want 2", got)
+	}
+}
+
+func TestPolicySharesPrompts(t *testing.T) {
+	script := func(s string) SocketMessage {
+		return SocketMessage{Action: "executeScript", Params: map[string]interface{}{"script": s}}
+	}
+
+	tests := []struct {
+		name    string
+		scripts []string
+		// wantPrompts is how many prompts are shown in turn
+		wantPrompts []string
+	}{
+		{"identical requests share one prompt", []string{"a", "a", "a"}, []string{"a"}},
+		{"different request asks after the first", []string{"a", "b"}, []string{"a", "b"}},
+		{"waiters for each prompt share it", []string{"a", "b", "b", "a"}, []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bridge := &fakeBridge{
+				tab:     PolicyTarget{TabId: 1, URL: "https://a.com/"},
+				approve: true,
+				release: make(chan struct{}),
+			}
+			policy := NewPolicyEngine(DefaultPolicyConfig(), bridge)
+
+			// The first request opens the prompt, the rest queue behind it
+			errs := make(chan error, len(tt.scripts))
+			go func() {
+				_, err := policy.Check(script(tt.scripts[0]))
+				errs <- err
+			}()
+			waitFor(t, func() bool { return bridge.promptCount() == 1 })
+			for _, s := range tt.scripts[1:] {
+				go func(s string) {
+					_, err := policy.Check(script(s))
+					errs <- err
+				}(s)
+			}
+
+			// Answer the prompts one at a time, once the others are waiting
+			for i := range tt.wantPrompts {
+				waitFor(t, func() bool { return bridge.promptCount() == i+1 })
+				time.Sleep(50 * time.Millisecond)
+				bridge.release <- struct{}{}
+			}
+
+			for range tt.scripts {
+				if err := <-errs; err != nil {
+					t.Errorf("Check failed: %v", err)
+				}
+			}
+			bridge.mutex.Lock()
+			defer bridge.mutex.Unlock()
+			if fmt.Sprint(bridge.prompts) != fmt.Sprint(tt.wantPrompts) {
+				t.Errorf("prompts = %q, want %q", bridge.prompts, tt.wantPrompts)
+			}
+		})
+	}
+}
+
+func TestPolicySharedPromptDenied(t *testing.T) {
+	bridge := &fakeBridge{tab: PolicyTarget{TabId: 1, URL: "https://a.com/"}, release: make(chan struct{})}
+	policy := NewPolicyEngine(DefaultPolicyConfig(), bridge)
+	msg := SocketMessage{Action: "modifyDom", Params: map[string]interface{}{"action": "remove", "selector": "#ad"}}
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := policy.Check(msg)
+			errs <- err
+		}()
+	}
+	waitFor(t, func() bool { return bridge.promptCount() == 1 })
+	time.Sleep(50 * time.Millisecond)
+	bridge.release <- struct{}{}
+
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err == nil {
+			t.Error("a request sharing a denied prompt went through")
+		}
+	}
+	if got := bridge.promptCount(); got != 1 {
+		t.Errorf("%d prompts, want 1", got)
+	}
+}
+
+func TestCheckLocal(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  PolicyConfig
+		action  string
+		approve bool
+		wantErr bool
+	}{
+		{"allowed", PolicyConfig{}, "runCommand", false, false},
+		{"asks by default", DefaultPolicyConfig(), "runCommand", false, true},
+		{"approved by default prompt", DefaultPolicyConfig(), "runCommand", true, false},
+		{"blocked in read-only mode", PolicyConfig{ReadOnly: true}, "runCommand", false, true},
+		{"reads allowed in read-only mode", PolicyConfig{ReadOnly: true}, "getTerminalScreen", false, false},
+		{"denied action", PolicyConfig{Actions: map[string]string{"runCommand": PolicyDeny}}, "runCommand", false, true},
+		{"origin rules don't apply", PolicyConfig{
+			AllowOrigins: []string{"example.com"},
+			Origins:      map[string]map[string]string{"*": {"runCommand": PolicyDeny}},
+		}, "runCommand", false, false},
+		{"ask and approved", PolicyConfig{Actions: map[string]string{"runCommand": PolicyAsk}}, "runCommand", true, false},
+		{"ask and denied", PolicyConfig{Actions: map[string]string{"runCommand": PolicyAsk}}, "runCommand", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The active tab is never looked up for local actions
+			bridge := &fakeBridge{tabErr: fmt.Errorf("no tab"), approve: tt.approve}
+			policy := NewPolicyEngine(tt.config, bridge)
+			err := policy.CheckLocal(SocketMessage{Action: tt.action, Params: map[string]interface{}{"command": "ls"}})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckLocal(%s) = %v, wantErr %v", tt.action, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// waitFor polls cond for up to a second
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatal("timed out waiting")
+}
@@ -0,0 +1,177 @@
+// Launch Profiles
+//
+// Describes what runs in the terminal: command, arguments, working
+// directory, environment and model. Profiles come from the terminal
+// section of config.json and are selected with terminal:start.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LaunchProfile is one way of starting the terminal process
+type LaunchProfile struct {
+	// Command is a path or a name looked up in PATH (plus the Homebrew and
+	// npm locations). Empty starts the user's login shell.
+	Command string            `json:"command"`
+	Args    []string          `json:"args"`
+	Cwd     string            `json:"cwd"` // overrides the remembered workspace
+	Env     map[string]string `json:"env"`
+	// Model is passed to the command as --model
+	Model string `json:"model"`
+}
+
+// TerminalConfig holds the terminal section of config.json
+type TerminalConfig struct {
+	DefaultProfile string                   `json:"defaultProfile"`
+	Profiles       map[string]LaunchProfile `json:"profiles"`
+	// Workspaces are project directories offered in the side panel
+	Workspaces []string `json:"workspaces"`
+	// Restart decides what happens when the process exits on its own
+	Restart RestartPolicy `json:"restart"`
+	// StopTimeoutMs is how long a stopped process gets to exit before it
+	// is killed
+	StopTimeoutMs int `json:"stopTimeoutMs"`
+	// Recording configures asciicast recordings of sessions
+	Recording RecordingConfig `json:"recording"`
+}
+
+// Built-in profile names
+const (
+	ProfileGemini = "gemini"
+	ProfileShell  = "shell"
+)
+
+// DefaultTerminalConfig runs Gemini CLI, with a login shell profile available
+func DefaultTerminalConfig() TerminalConfig {
+	return TerminalConfig{
+		DefaultProfile: ProfileGemini,
+		Profiles: map[string]LaunchProfile{
+			ProfileGemini: {
+				Command: "gemini",
+				// Force color output
+				Env: map[string]string{"FORCE_COLOR": "1"},
+			},
+			ProfileShell: {},
+		},
+		Restart:       DefaultRestartPolicy(),
+		StopTimeoutMs: int(DefaultStopTimeout / time.Millisecond),
+	}
+}
+
+// UnmarshalJSON merges configured profiles field by field onto the
+// built-in profile of the same name, so {"gemini": {"model": "x"}} keeps
+// the gemini command instead of replacing the whole profile
+func (c *TerminalConfig) UnmarshalJSON(data []byte) error {
+	type plain TerminalConfig
+	raw := struct {
+		*plain
+		Profiles map[string]json.RawMessage `json:"profiles"`
+	}{plain: (*plain)(c)}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.Profiles == nil {
+		return nil
+	}
+
+	profiles := make(map[string]LaunchProfile, len(c.Profiles)+len(raw.Profiles))
+	for name, profile := range c.Profiles {
+		profiles[name] = profile
+	}
+	for name, data := range raw.Profiles {
+		profile := profiles[name]
+		if err := json.Unmarshal(data, &profile); err != nil {
+			return fmt.Errorf("profile %q: %w", name, err)
+		}
+		profiles[name] = profile
+	}
+	c.Profiles = profiles
+	return nil
+}
+
+// Profile returns the named profile, or the default profile when name is empty
+func (c TerminalConfig) Profile(name string) (LaunchProfile, string, error) {
+	if name == "" {
+		name = c.DefaultProfile
+	}
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return LaunchProfile{}, name, fmt.Errorf("unknown launch profile %q (available: %s)", name, strings.Join(c.ProfileNames(), ", "))
+	}
+	return profile, name, nil
+}
+
+// ProfileNames returns the configured profile names, sorted
+func (c TerminalConfig) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// commandLine resolves the executable and arguments for a profile
+func (p LaunchProfile) commandLine() (string, []string, error) {
+	args := append([]string{}, p.Args...)
+	if p.Model != "" {
+		args = append(args, "--model", p.Model)
+	}
+
+	if p.Command == "" {
+		// Don't hand --model or Gemini's arguments to the shell
+		if len(args) > 0 {
+			return "", nil, fmt.Errorf("profile sets model or args but no command; set \"command\" (a login shell is only started when all three are empty)")
+		}
+		shell := os.Getenv("SHELL")
+		if shell == "" {
+			shell = "/bin/zsh"
+		}
+		// Start as login shell for proper initialization
+		return shell, []string{"-l"}, nil
+	}
+
+	path, err := lookPath(p.Command)
+	if err != nil {
+		return "", nil, err
+	}
+	return path, args, nil
+}
+
+// lookPath finds command in the enhanced PATH. Chrome starts the host with
+// a minimal PATH, so the usual PATH lookup misses Homebrew and npm installs.
+func lookPath(command string) (string, error) {
+	command = expandHome(command)
+	if strings.Contains(command, "/") {
+		if info, err := os.Stat(command); err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+			return "", fmt.Errorf("%s is not an executable file", command)
+		}
+		return command, nil
+	}
+
+	dirs := filepath.SplitList(getEnhancedPath())
+	for _, dir := range dirs {
+		candidate := filepath.Join(dir, command)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%s not found in PATH (searched %s)", command, strings.Join(dirs, ", "))
+}
+
+// expandHome replaces a leading ~ with the home directory
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		homeDir, _ := os.UserHomeDir()
+		return filepath.Join(homeDir, strings.TrimPrefix(path, "~"))
+	}
+	return path
+}
@@ -0,0 +1,272 @@
+// Native Messaging Message Schema
+//
+// Typed messages exchanged with the Chrome extension. Frames from Chrome
+// are decoded by their "type" field into one of the structs below, so a
+// malformed or unsupported message is reported back instead of being
+// half-read. Both sides open the connection with a hello message carrying
+// their protocol version and capabilities; incompatible versions produce a
+// protocol:error the side panel shows.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// HostVersion is the native host release
+const HostVersion = "1.0.0"
+
+// ProtocolVersion is bumped when a message changes incompatibly. The host
+// talks to extensions speaking MinProtocolVersion through ProtocolVersion.
+const (
+	ProtocolVersion    = 1
+	MinProtocolVersion = 1
+)
+
+// IncomingMessage is a decoded message from Chrome
+type IncomingMessage interface {
+	MessageType() string
+}
+
+// incomingTypes maps each message type Chrome may send to its struct
+var incomingTypes = map[string]func() IncomingMessage{
+	"hello":              func() IncomingMessage { return &HelloMessage{} },
+	"terminal:input":     func() IncomingMessage { return &TerminalInputMessage{} },
+	"terminal:resize":    func() IncomingMessage { return &TerminalResizeMessage{} },
+	"terminal:signal":    func() IncomingMessage { return &TerminalSignalMessage{} },
+	"terminal:recording": func() IncomingMessage { return &TerminalRecordingMessage{} },
+	"terminal:start":     func() IncomingMessage { return &TerminalStartMessage{} },
+	"terminal:restart":   func() IncomingMessage { return &TerminalRestartMessage{} },
+	"terminal:profiles":  func() IncomingMessage { return &TerminalProfilesMessage{} },
+	"terminal:inject":    func() IncomingMessage { return &TerminalInjectMessage{} },
+	"browser:response":   func() IncomingMessage { return &BrowserResponse{} },
+	"browser:approval":   func() IncomingMessage { return &BrowserResponse{} },
+	"browser:event":      func() IncomingMessage { return &BrowserEventMessage{} },
+	"host:pong":          func() IncomingMessage { return &HostPongMessage{} },
+}
+
+// HostCapabilities lists the message types the host accepts
+func HostCapabilities() []string {
+	types := make([]string, 0, len(incomingTypes))
+	for t := range incomingTypes {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// UnknownTypeError is returned for a message type the host doesn't handle
+type UnknownTypeError struct {
+	Type string
+}
+
+func (e *UnknownTypeError) Error() string {
+	if e.Type == "" {
+		return "message has no type"
+	}
+	return fmt.Sprintf("unsupported message type %q", e.Type)
+}
+
+// DecodeMessage decodes a frame from Chrome into its typed message
+func DecodeMessage(raw json.RawMessage) (IncomingMessage, error) {
+	var envelope struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to parse message JSON: %w", err)
+	}
+
+	newMessage, ok := incomingTypes[envelope.Type]
+	if !ok {
+		return nil, &UnknownTypeError{Type: envelope.Type}
+	}
+	msg := newMessage()
+	if err := json.Unmarshal(raw, msg); err != nil {
+		return nil, fmt.Errorf("invalid %s message: %w", envelope.Type, err)
+	}
+	if r, ok := msg.(*BrowserResponse); ok {
+		// browser:response and browser:approval share a struct
+		r.Type = envelope.Type
+	}
+	return msg, nil
+}
+
+// HelloMessage opens the connection in both directions
+type HelloMessage struct {
+	Type               string   `json:"type"`
+	ProtocolVersion    int      `json:"protocolVersion"`
+	MinProtocolVersion int      `json:"minProtocolVersion,omitempty"`
+	Capabilities       []string `json:"capabilities"`
+	// Version is the extension or host release, for error messages
+	Version string `json:"version,omitempty"`
+	// Extension only: a per-profile id kept in extension storage, and the
+	// browser's name, so MCP clients can tell hosts apart
+	InstanceId string `json:"instanceId,omitempty"`
+	Browser    string `json:"browser,omitempty"`
+}
+
+func (m *HelloMessage) MessageType() string { return "hello" }
+
+// NewHostHello returns the hello the host sends when Chrome connects
+func NewHostHello() HelloMessage {
+	return HelloMessage{
+		Type:               "hello",
+		ProtocolVersion:    ProtocolVersion,
+		MinProtocolVersion: MinProtocolVersion,
+		Capabilities:       HostCapabilities(),
+		Version:            HostVersion,
+	}
+}
+
+// Supports reports whether the peer announced a capability
+func (m *HelloMessage) Supports(capability string) bool {
+	for _, c := range m.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckCompatible returns an error explaining which side to update when
+// the extension's protocol range doesn't overlap the host's
+func (m *HelloMessage) CheckCompatible() error {
+	minimum := m.MinProtocolVersion
+	if minimum == 0 {
+		minimum = m.ProtocolVersion
+	}
+	switch {
+	case m.ProtocolVersion < MinProtocolVersion:
+		return fmt.Errorf("the Chrome extension speaks protocol v%d but the native host needs v%d or newer. Update and reload the extension",
+			m.ProtocolVersion, MinProtocolVersion)
+	case minimum > ProtocolVersion:
+		return fmt.Errorf("the Chrome extension needs protocol v%d or newer but the native host (%s) speaks v%d. Re-run install.sh to update the native host",
+			minimum, HostVersion, ProtocolVersion)
+	}
+	return nil
+}
+
+// TerminalInputMessage carries keystrokes or a paste for the PTY
+type TerminalInputMessage struct {
+	Data string `json:"data,omitempty"`
+	// DataBase64 carries raw bytes instead of Data, for input that isn't
+	// valid UTF-8
+	DataBase64 string `json:"dataBase64,omitempty"`
+	// Paste wraps the input in bracketed-paste markers if the program
+	// enabled them
+	Paste bool `json:"paste,omitempty"`
+}
+
+func (m *TerminalInputMessage) MessageType() string { return "terminal:input" }
+
+// TerminalResizeMessage reports the side panel terminal's size
+type TerminalResizeMessage struct {
+	Cols int `json:"cols"`
+	Rows int `json:"rows"`
+}
+
+func (m *TerminalResizeMessage) MessageType() string { return "terminal:resize" }
+
+// TerminalSignalMessage asks for a signal to the foreground process
+type TerminalSignalMessage struct {
+	Params struct {
+		Signal string `json:"signal"`
+	} `json:"params"`
+}
+
+func (m *TerminalSignalMessage) MessageType() string { return "terminal:signal" }
+
+// TerminalRecordingMessage starts or stops recording; other actions just
+// ask for the state
+type TerminalRecordingMessage struct {
+	RequestId string `json:"requestId,omitempty"`
+	Params    struct {
+		Action string `json:"action"`
+		// Input overrides terminal.recording.input when set
+		Input *bool `json:"input,omitempty"`
+	} `json:"params"`
+}
+
+func (m *TerminalRecordingMessage) MessageType() string { return "terminal:recording" }
+
+// TerminalStartMessage replaces the session with another profile and/or
+// working directory
+type TerminalStartMessage struct {
+	Params struct {
+		Profile string `json:"profile,omitempty"`
+		Cwd     string `json:"cwd,omitempty"`
+	} `json:"params"`
+}
+
+func (m *TerminalStartMessage) MessageType() string { return "terminal:start" }
+
+// TerminalRestartMessage starts the last session again
+type TerminalRestartMessage struct{}
+
+func (m *TerminalRestartMessage) MessageType() string { return "terminal:restart" }
+
+// TerminalProfilesMessage asks for the launch profiles and workspaces
+type TerminalProfilesMessage struct{}
+
+func (m *TerminalProfilesMessage) MessageType() string { return "terminal:profiles" }
+
+// TerminalInjectMessage asks for browser context to be pasted into the prompt
+type TerminalInjectMessage struct {
+	RequestId string       `json:"requestId,omitempty"`
+	Params    InjectParams `json:"params"`
+}
+
+func (m *TerminalInjectMessage) MessageType() string { return "terminal:inject" }
+
+// InjectParams selects what terminal:inject sends
+type InjectParams struct {
+	// Sources is any of url, selection and text
+	Sources  []string `json:"sources,omitempty"`
+	MaxChars int      `json:"maxChars,omitempty"`
+}
+
+// BrowserRequest represents a request (or approval prompt) sent to Chrome
+type BrowserRequest struct {
+	Type      string      `json:"type"`
+	Action    string      `json:"action"`
+	Params    interface{} `json:"params,omitempty"`
+	RequestId string      `json:"requestId"`
+}
+
+// BrowserResponse represents a response (or approval decision) from Chrome
+type BrowserResponse struct {
+	Type      string      `json:"type"`
+	RequestId string      `json:"requestId"`
+	Success   bool        `json:"success"`
+	Data      interface{} `json:"data,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+func (m *BrowserResponse) MessageType() string { return m.Type }
+
+// BrowserEventMessage is an event Chrome pushes without being asked
+type BrowserEventMessage struct {
+	Topic string      `json:"topic"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+func (m *BrowserEventMessage) MessageType() string { return "browser:event" }
+
+// HostPongMessage answers a host:ping
+type HostPongMessage struct {
+	RequestId string `json:"requestId"`
+}
+
+func (m *HostPongMessage) MessageType() string { return "host:pong" }
+
+// Message is a status or reply frame sent to the side panel
+// (terminal:output, terminal:exit, protocol:error, host:ping, ...)
+type Message struct {
+	Type      string      `json:"type"`
+	RequestId string      `json:"requestId,omitempty"`
+	Success   bool        `json:"success,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
@@ -1,36 +1,100 @@
 // PTY Manager
 //
 // Manages the pseudo-terminal for running the shell.
-// Handles spawning, I/O, and resizing.
+// Handles spawning, I/O, resizing, signals and shutdown. Each session runs
+// in its own process group so stopping it also stops whatever it spawned.
 
 package main
 
 import (
+	"errors"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+	"unsafe"
 
 	"github.com/creack/pty"
 )
 
+// DefaultStopTimeout is how long a stopped session gets to exit before it
+// is killed
+const DefaultStopTimeout = 3 * time.Second
+
 // PTYManager manages a pseudo-terminal
 type PTYManager struct {
-	cmd       *exec.Cmd
-	ptmx      *os.File
-	outputCh  chan string
-	running   bool
-	mutex     sync.Mutex
-	closeChan chan struct{}
+	cmd         *exec.Cmd
+	ptmx        *os.File
+	exited      chan struct{} // closed when cmd has been reaped
+	stopTimeout time.Duration
+	outputCh    chan PTYOutput
+	running     bool
+	profile     string
+	cwd         string
+	startedAt   time.Time
+	generation  int
+	cols        int
+	rows        int
+	// Recording carries over to sessions that replace the current one
+	recording   bool
+	recordDir   string
+	recordInput bool
+	recorder    *Recorder
+	// recordErr is why recording stopped when the last session started
+	recordErr error
+	// screen mirrors what the side panel shows, for agents to read
+	screen *TerminalScreen
+	// input is written to the PTY in order by inputLoop
+	inputCh chan inputRequest
+	mutex   sync.Mutex
+}
+
+// PTYOutput is an item from OutputChan: terminal data or, once a session's
+// process has exited and its output is drained, the exit status
+type PTYOutput struct {
+	Data string
+	Exit *PTYExit
+}
+
+// PTYExit describes a session whose process exited on its own (not one
+// stopped or replaced by the host)
+type PTYExit struct {
+	Profile string `json:"profile"`
+	Cwd     string `json:"cwd"`
+	// Code is the exit code, or -1 when the process was killed by a signal
+	Code     int    `json:"code"`
+	Signal   string `json:"signal,omitempty"`
+	UptimeMs int64  `json:"uptimeMs"`
+	// Generation identifies the session, see PTYManager.Generation
+	Generation int `json:"-"`
 }
 
-// NewPTYManager creates a new PTY manager
-func NewPTYManager() *PTYManager {
-	return &PTYManager{
-		outputCh:  make(chan string, 100),
-		closeChan: make(chan struct{}),
+// Failed reports whether the exit should count as a crash
+func (e PTYExit) Failed() bool {
+	return e.Code != 0 || e.Signal != ""
+}
+
+// NewPTYManager creates a new PTY manager. stopTimeout is the grace period
+// between asking a session to exit and killing it (DefaultStopTimeout when
+// zero).
+func NewPTYManager(stopTimeout time.Duration) *PTYManager {
+	if stopTimeout <= 0 {
+		stopTimeout = DefaultStopTimeout
+	}
+	p := &PTYManager{
+		outputCh:    make(chan PTYOutput, 100),
+		stopTimeout: stopTimeout,
+		screen:      NewTerminalScreen(80, 24, DefaultScrollbackLines),
+		inputCh:     make(chan inputRequest, 256),
 	}
+	go p.inputLoop()
+	return p
 }
 
 // getEnhancedPath returns PATH with common binary locations added
@@ -56,145 +120,215 @@ func getEnhancedPath() string {
 	return currentPath
 }
 
-// Start starts the PTY with Gemini CLI
-func (p *PTYManager) Start() error {
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
-
-	// Enhanced PATH for finding gemini
-	enhancedPath := getEnhancedPath()
-
-	// Look for gemini with enhanced PATH
-	geminiPath := ""
-	for _, dir := range []string{"/opt/homebrew/bin", "/usr/local/bin"} {
-		candidate := dir + "/gemini"
-		if _, err := os.Stat(candidate); err == nil {
-			geminiPath = candidate
-			break
-		}
-	}
-
-	// Also try exec.LookPath with enhanced PATH
-	if geminiPath == "" {
-		os.Setenv("PATH", enhancedPath)
-		if path, err := exec.LookPath("gemini"); err == nil {
-			geminiPath = path
-		}
+// Start runs the named launch profile in a new PTY in directory cwd,
+// replacing any process already running (which is stopped in the
+// background). Output from every session goes to the same channel,
+// followed by the exit status if the process exits on its own.
+func (p *PTYManager) Start(name string, profile LaunchProfile, cwd string) error {
+	path, args, err := profile.commandLine()
+	if err != nil {
+		return err
 	}
 
-	if geminiPath == "" {
-		log.Printf("[PTY] Gemini CLI not found, falling back to shell")
-		return p.startShell()
+	// Check the directory up front: a bad cwd otherwise surfaces as an
+	// obscure fork/exec error
+	dir, err := validateWorkspace(cwd)
+	if err != nil {
+		return err
 	}
 
-	// Create command for Gemini CLI
-	p.cmd = exec.Command(geminiPath)
-	p.cmd.Env = append(os.Environ(),
+	cmd := exec.Command(path, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
 		"TERM=xterm-256color",
 		"COLORTERM=truecolor",
-		"PATH="+enhancedPath,
-		// Force color output
-		"FORCE_COLOR=1",
+		"PATH="+getEnhancedPath(),
 	)
+	for key, value := range profile.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	// New session (and so process group) with the PTY as controlling terminal
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if old := p.detachLocked(); old != nil {
+		go old.stop(p.stopTimeout)
+	}
+	p.closeRecorderLocked()
 
-	// Start with PTY
-	var err error
-	p.ptmx, err = pty.Start(p.cmd)
+	// Start with PTY, keeping the size of the previous session
+	var size *pty.Winsize
+	if p.cols > 0 && p.rows > 0 {
+		size = &pty.Winsize{Cols: uint16(p.cols), Rows: uint16(p.rows)}
+	}
+	ptmx, err := pty.StartWithAttrs(cmd, size, cmd.SysProcAttr)
 	if err != nil {
-		log.Printf("[PTY] Failed to start Gemini CLI: %v, falling back to shell", err)
-		return p.startShell()
+		return fmt.Errorf("failed to start %s: %w", path, err)
 	}
 
+	exited := make(chan struct{})
+	p.cmd = cmd
+	p.ptmx = ptmx
+	p.exited = exited
 	p.running = true
-	log.Printf("[PTY] Started Gemini CLI: %s", geminiPath)
+	p.profile = name
+	p.cwd = dir
+	p.startedAt = time.Now()
+	p.generation++
+	generation := p.generation
+	slog.Info("[PTY] Started", "profile", name, "path", path, "args", args, "cwd", cmd.Dir, "pid", cmd.Process.Pid)
+
+	p.recordErr = nil
+	if p.recording {
+		if err := p.openRecorderLocked(); err != nil {
+			slog.Error("[PTY] Recording stopped", "error", err)
+			p.recording = false
+			p.recordErr = err
+		}
+	}
 
 	// Read PTY output in background
-	go p.readOutput()
+	readDone := make(chan struct{})
+	go func() {
+		p.readOutput(ptmx)
+		close(readDone)
+	}()
 
 	// Wait for process exit in background
 	go func() {
-		err := p.cmd.Wait()
-		log.Printf("[PTY] Gemini CLI exited: %v", err)
+		err := cmd.Wait()
+		close(exited)
+		slog.Info("[PTY] Process exited", "profile", name, "error", err)
+
+		// Let the last output through before reporting the exit. Children
+		// that keep the PTY open must not hold up the report forever.
+		select {
+		case <-readDone:
+		case <-time.After(time.Second):
+		}
+
 		p.mutex.Lock()
-		p.running = false
+		current := p.cmd == cmd
+		if current {
+			p.running = false
+		}
+		startedAt := p.startedAt
 		p.mutex.Unlock()
-		close(p.closeChan)
+
+		// Sessions stopped or replaced by the host are not reported
+		if current {
+			exit := exitStatus(cmd, name, dir, startedAt, generation)
+			p.outputCh <- PTYOutput{Exit: &exit}
+		}
 	}()
 
 	return nil
 }
 
-// startShell starts a fallback shell (used when Gemini CLI is not available)
-func (p *PTYManager) startShell() error {
-	shell := os.Getenv("SHELL")
-	if shell == "" {
-		shell = "/bin/zsh"
+// exitStatus describes how cmd ended
+func exitStatus(cmd *exec.Cmd, profile, cwd string, startedAt time.Time, generation int) PTYExit {
+	exit := PTYExit{
+		Profile:    profile,
+		Cwd:        cwd,
+		Code:       cmd.ProcessState.ExitCode(),
+		UptimeMs:   time.Since(startedAt).Milliseconds(),
+		Generation: generation,
 	}
-
-	// Start as login shell for proper initialization
-	p.cmd = exec.Command(shell, "-l")
-	p.cmd.Env = append(os.Environ(),
-		"TERM=xterm-256color",
-		"COLORTERM=truecolor",
-		"PATH="+getEnhancedPath(),
-	)
-
-	var err error
-	p.ptmx, err = pty.Start(p.cmd)
-	if err != nil {
-		return err
+	if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		exit.Signal = status.Signal().String()
 	}
+	return exit
+}
 
-	p.running = true
-	log.Printf("[PTY] Started fallback shell: %s -l", shell)
-
-	go p.readOutput()
-
-	go func() {
-		err := p.cmd.Wait()
-		log.Printf("[PTY] Shell exited: %v", err)
-		p.mutex.Lock()
-		p.running = false
-		p.mutex.Unlock()
-		close(p.closeChan)
-	}()
+// Generation increases every time a session is started
+func (p *PTYManager) Generation() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.generation
+}
 
-	return nil
+// readOutput reads from PTY and sends to output channel. Reads can end in
+// the middle of a multi-byte character (box drawing, emoji); those bytes
+// are held back for the next frame, since JSON encoding would turn each
+// half into U+FFFD.
+func (p *PTYManager) readOutput(ptmx *os.File) {
+	readUTF8Frames(ptmx, func(data []byte) {
+		p.sendOutput(ptmx, data)
+	})
 }
 
-// readOutput reads from PTY and sends to output channel
-func (p *PTYManager) readOutput() {
-	buf := make([]byte, 4096)
+// readUTF8Frames reads r until it fails and passes the data to send,
+// holding back an incomplete UTF-8 sequence at the end of a read until the
+// next one completes it
+func readUTF8Frames(r io.Reader, send func([]byte)) {
+	const readSize = 4096
+	buf := make([]byte, readSize+utf8.UTFMax)
+	carry := 0
 	for {
-		n, err := p.ptmx.Read(buf)
+		n, err := r.Read(buf[carry : carry+readSize])
 		if err != nil {
-			if err != io.EOF {
-				log.Printf("[PTY] Read error: %v", err)
+			// ErrClosed: the session was stopped or replaced. EIO: Linux
+			// reports the other end closing this way instead of EOF.
+			if err != io.EOF && !errors.Is(err, os.ErrClosed) && !errors.Is(err, syscall.EIO) {
+				slog.Error("[PTY] Read error", "error", err)
 			}
-			return
-		}
-		if n > 0 {
-			select {
-			case p.outputCh <- string(buf[:n]):
-			default:
-				// Channel full, drop data
-				log.Println("[PTY] Output channel full, dropping data")
+			// Whatever is left can never be completed
+			if carry > 0 {
+				send(buf[:carry])
 			}
+			return
 		}
+		n += carry
+		end := utf8Boundary(buf[:n])
+		send(buf[:end])
+		carry = copy(buf, buf[end:n])
 	}
 }
 
-// Write sends data to the PTY
-func (p *PTYManager) Write(data []byte) error {
+// sendOutput queues a frame of output from ptmx
+func (p *PTYManager) sendOutput(ptmx *os.File, data []byte) {
+	if len(data) == 0 {
+		return
+	}
 	p.mutex.Lock()
-	defer p.mutex.Unlock()
-
-	if p.ptmx == nil {
-		return nil
+	current := p.ptmx == ptmx
+	recorder := p.recorder
+	p.mutex.Unlock()
+
+	if !current {
+		// A stopped session saying goodbye; don't mix it into the
+		// session that replaced it
+		slog.Debug("[PTY] Discarding output of stopped session", "bytes", len(data))
+		return
+	}
+	if recorder != nil {
+		recorder.Output(data)
 	}
+	p.screen.Write(data)
+	select {
+	case p.outputCh <- PTYOutput{Data: string(data)}:
+	default:
+		// Channel full, drop data
+		slog.Warn("[PTY] Output channel full, dropping data", "bytes", len(data))
+		hostMetrics.AddDroppedPTYBytes(len(data))
+	}
+}
 
-	_, err := p.ptmx.Write(data)
-	return err
+// utf8Boundary returns the length of the longest prefix of b that doesn't
+// end partway through a UTF-8 sequence. Invalid bytes are not held back;
+// they can't be completed by the next read anyway.
+func utf8Boundary(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if utf8.FullRune(b[i:]) {
+				return len(b)
+			}
+			return i
+		}
+	}
+	return len(b)
 }
 
 // Resize resizes the PTY
@@ -202,11 +336,16 @@ func (p *PTYManager) Resize(cols, rows int) error {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
+	p.cols, p.rows = cols, rows
+	p.screen.Resize(cols, rows)
 	if p.ptmx == nil {
 		return nil
 	}
 
-	log.Printf("[PTY] Resizing to %dx%d", cols, rows)
+	slog.Debug("[PTY] Resizing", "cols", cols, "rows", rows)
+	if p.recorder != nil {
+		p.recorder.Resize(cols, rows)
+	}
 	return pty.Setsize(p.ptmx, &pty.Winsize{
 		Cols: uint16(cols),
 		Rows: uint16(rows),
@@ -214,7 +353,7 @@ func (p *PTYManager) Resize(cols, rows int) error {
 }
 
 // OutputChan returns the output channel
-func (p *PTYManager) OutputChan() <-chan string {
+func (p *PTYManager) OutputChan() <-chan PTYOutput {
 	return p.outputCh
 }
 
@@ -225,16 +364,238 @@ func (p *PTYManager) IsRunning() bool {
 	return p.running
 }
 
-// Stop stops the PTY
-func (p *PTYManager) Stop() {
+// Profile returns the name of the running launch profile
+func (p *PTYManager) Profile() string {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
+	return p.profile
+}
 
-	if p.ptmx != nil {
-		p.ptmx.Close()
+// Cwd returns the working directory of the running session
+func (p *PTYManager) Cwd() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.cwd
+}
+
+// Signals the side panel may send to the foreground process
+var forwardedSignals = map[string]syscall.Signal{
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGTSTP": syscall.SIGTSTP,
+	"SIGCONT": syscall.SIGCONT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGHUP":  syscall.SIGHUP,
+}
+
+// Signal sends a signal (e.g. "SIGINT" or "INT") to the terminal's
+// foreground process group, as the terminal driver does for Ctrl-C. Gemini
+// CLI reads Ctrl-C as a key in raw mode, so this is the way to interrupt it
+// for real.
+func (p *PTYManager) Signal(name string) error {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig, ok := forwardedSignals[name]
+	if !ok {
+		return fmt.Errorf("unsupported signal %q", name)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.cmd == nil || !p.running {
+		return fmt.Errorf("terminal is not running")
+	}
+
+	// Whatever job the shell put in the foreground, or else the session's
+	// own group
+	pgid, err := foregroundGroup(p.ptmx)
+	if err != nil || pgid <= 0 {
+		pgid = p.cmd.Process.Pid
+	}
+	slog.Info("[PTY] Sending signal", "signal", name, "pgid", pgid)
+	return syscall.Kill(-pgid, sig)
+}
+
+// foregroundGroup returns the foreground process group of the terminal
+func foregroundGroup(ptmx *os.File) (int, error) {
+	var pgid int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, ptmx.Fd(), uintptr(syscall.TIOCGPGRP), uintptr(unsafe.Pointer(&pgid)))
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(pgid), nil
+}
+
+// Screen returns the emulated terminal screen
+func (p *PTYManager) Screen() *TerminalScreen {
+	return p.screen
+}
+
+// handleTerminalScreen serves the getTerminalScreen socket action. params
+// may contain "scrollbackLines" (default 50).
+func (p *PTYManager) handleTerminalScreen(params interface{}) (interface{}, error) {
+	par, _ := params.(map[string]interface{})
+	lines := 50
+	if l, ok := par["scrollbackLines"].(float64); ok && l >= 0 {
+		lines = int(l)
+	}
+
+	p.mutex.Lock()
+	running, profile := p.running, p.profile
+	p.mutex.Unlock()
+
+	return map[string]interface{}{
+		"running":  running,
+		"profile":  profile,
+		"snapshot": p.screen.Snapshot(lines),
+	}, nil
+}
+
+// StartRecording records the running session, and every session started
+// after it, to asciicast files in dir. Returns the current recording's path
+// (empty when no session is running yet).
+func (p *PTYManager) StartRecording(dir string, input bool) (string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.recording = true
+	p.recordDir = dir
+	p.recordInput = input
+	if p.recorder == nil && p.cmd != nil {
+		if err := p.openRecorderLocked(); err != nil {
+			p.recording = false
+			return "", err
+		}
+	}
+	return p.recordingPathLocked(), nil
+}
+
+// StopRecording stops recording and returns the path of the finished file
+func (p *PTYManager) StopRecording() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	path := p.recordingPathLocked()
+	p.recording = false
+	p.closeRecorderLocked()
+	return path
+}
+
+// Recording returns whether sessions are being recorded, and the current
+// file
+func (p *PTYManager) Recording() (bool, string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.recording, p.recordingPathLocked()
+}
+
+// RecordingError returns why recording stopped when the current session
+// started, or nil
+func (p *PTYManager) RecordingError() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.recordErr
+}
+
+func (p *PTYManager) recordingPathLocked() string {
+	if p.recorder == nil {
+		return ""
+	}
+	return p.recorder.Path()
+}
+
+func (p *PTYManager) openRecorderLocked() error {
+	recorder, err := NewRecorder(p.recordDir, p.profile, p.cols, p.rows, p.recordInput)
+	if err != nil {
+		return err
+	}
+	p.recorder = recorder
+	return nil
+}
+
+func (p *PTYManager) closeRecorderLocked() {
+	if p.recorder != nil {
+		p.recorder.Close()
+		p.recorder = nil
+	}
+}
+
+// Stop stops the PTY, waiting for the process to exit
+func (p *PTYManager) Stop() {
+	p.mutex.Lock()
+	old := p.detachLocked()
+	p.closeRecorderLocked()
+	p.mutex.Unlock()
+
+	if old != nil {
+		old.stop(p.stopTimeout)
 	}
+}
+
+// detachLocked forgets the current session so its exit isn't reported, and
+// returns it for stopping
+func (p *PTYManager) detachLocked() *ptySession {
+	var s *ptySession
 	if p.cmd != nil && p.cmd.Process != nil {
-		p.cmd.Process.Kill()
+		s = &ptySession{cmd: p.cmd, ptmx: p.ptmx, exited: p.exited}
+	} else if p.ptmx != nil {
+		p.ptmx.Close()
 	}
+	p.ptmx = nil
+	p.cmd = nil
+	p.exited = nil
 	p.running = false
+	return s
+}
+
+// ptySession is a detached session being stopped
+type ptySession struct {
+	cmd    *exec.Cmd
+	ptmx   *os.File
+	exited chan struct{}
+}
+
+// stop asks the session's process group to exit with SIGHUP and SIGTERM
+// (giving Gemini CLI a chance to save its state), and kills the group if
+// it is still running after timeout
+func (s *ptySession) stop(timeout time.Duration) {
+	defer s.ptmx.Close()
+
+	// Signal the group even when the leader is gone: its children may still
+	// be running
+	pid := s.cmd.Process.Pid
+	slog.Info("[PTY] Stopping", "pgid", pid, "timeout", timeout)
+	syscall.Kill(-pid, syscall.SIGHUP)
+	syscall.Kill(-pid, syscall.SIGTERM)
+
+	// Give the whole group until the deadline, not just the leader: a child
+	// that ignores SIGTERM outlives a shell that exits on it
+	deadline := time.Now().Add(timeout)
+	select {
+	case <-s.exited:
+	case <-time.After(timeout):
+	}
+	for groupAlive(pid) && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if !groupAlive(pid) {
+		slog.Info("[PTY] Stopped", "pgid", pid)
+		return
+	}
+	slog.Warn("[PTY] Process group did not exit in time, killing", "pgid", pid)
+	syscall.Kill(-pid, syscall.SIGKILL)
+	select {
+	case <-s.exited:
+	case <-time.After(time.Second):
+		slog.Error("[PTY] Process still running after SIGKILL", "pgid", pid)
+	}
+}
+
+// groupAlive reports whether any process is left in the process group
+func groupAlive(pgid int) bool {
+	return syscall.Kill(-pgid, 0) != syscall.ESRCH
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// chunkReader returns data in reads of the sizes given by cuts (1-8 bytes
+// each, cycling), so multi-byte characters get split at every offset
+type chunkReader struct {
+	data []byte
+	cuts []byte
+	n    int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	size := 1
+	if len(r.cuts) > 0 {
+		size = 1 + int(r.cuts[r.n%len(r.cuts)])%8
+	}
+	r.n++
+	size = min(size, len(r.data), len(p))
+	copy(p, r.data[:size])
+	r.data = r.data[size:]
+	return size, nil
+}
+
+func FuzzUTF8Boundary(f *testing.F) {
+	f.Add("plain ascii", []byte{0})
+	f.Add("héllo wörld", []byte{1, 2, 3})
+	f.Add("┌──┐│ box │└──┘", []byte{0, 1, 2, 3, 4, 5, 6, 7})
+	f.Add("emoji 🎉👍🏽 and 漢字", []byte{2, 4, 1})
+	f.Add("\x1b[31m❯\x1b[0m prompt", []byte{5, 0, 3})
+
+	f.Fuzz(func(t *testing.T, text string, cuts []byte) {
+		// Valid UTF-8 without U+FFFD, so any U+FFFD in the output is ours
+		text = strings.ReplaceAll(strings.ToValidUTF8(text, ""), "\uFFFD", "")
+
+		var out strings.Builder
+		readUTF8Frames(&chunkReader{data: []byte(text), cuts: cuts}, func(frame []byte) {
+			if !utf8.Valid(frame) {
+				t.Fatalf("frame %q is not valid UTF-8", frame)
+			}
+			if strings.ContainsRune(string(frame), utf8.RuneError) {
+				t.Fatalf("frame %q contains U+FFFD", frame)
+			}
+			out.Write(frame)
+		})
+
+		if out.String() != text {
+			t.Fatalf("reassembled %q, want %q", out.String(), text)
+		}
+	})
+}
+
+func TestUTF8Boundary(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want int
+	}{
+		{"empty", "", 0},
+		{"ascii", "abc", 3},
+		{"complete two-byte", "é", 2},
+		{"first byte of two", "a\xc3", 1},
+		{"two of three bytes", "a\xe2\x94", 1},
+		{"three of four bytes", "a\xf0\x9f\x8e", 1},
+		{"complete four-byte", "🎉", 4},
+		{"stray continuation byte", "a\x80", 2},
+		{"invalid byte", "a\xff", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := utf8Boundary([]byte(tt.in)); got != tt.want {
+				t.Errorf("utf8Boundary(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
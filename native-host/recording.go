@@ -0,0 +1,236 @@
+// Session Recording
+//
+// Records terminal sessions as asciicast v2 files (the asciinema format):
+// a JSON header line followed by one [time, type, data] line per output,
+// input or resize event. Recordings can be played back with
+// `gemini-browser-host replay <file>` or any asciicast player.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RecordingConfig holds terminal.recording in config.json
+type RecordingConfig struct {
+	// Dir receives the .cast files (default: recordings in the install dir)
+	Dir string `json:"dir"`
+	// Input also records keystrokes. Off by default: they may contain secrets.
+	Input bool `json:"input"`
+	// AutoStart records every session from the start
+	AutoStart bool `json:"autoStart"`
+}
+
+// RecordingsDir returns where recordings are written
+func (c RecordingConfig) RecordingsDir() string {
+	if c.Dir != "" {
+		return expandHome(c.Dir)
+	}
+	return filepath.Join(GetInstallDir(), "recordings")
+}
+
+// castHeader is the first line of an asciicast v2 file
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Recorder writes one session to an asciicast file
+type Recorder struct {
+	file    *os.File
+	path    string
+	input   bool
+	started time.Time
+	mutex   sync.Mutex
+}
+
+// NewRecorder creates a recording for a session of the named profile in dir
+func NewRecorder(dir, profile string, cols, rows int, input bool) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("cannot create recordings directory: %w", err)
+	}
+	if cols <= 0 || rows <= 0 {
+		cols, rows = 80, 24
+	}
+
+	now := time.Now()
+	file, path, err := createRecordingFile(dir, now.Format("20060102-150405")+"-"+sanitizeFilename(profile, "session"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create recording: %w", err)
+	}
+
+	header, _ := json.Marshal(castHeader{
+		Version:   2,
+		Width:     cols,
+		Height:    rows,
+		Timestamp: now.Unix(),
+		Title:     profile,
+		Env:       map[string]string{"TERM": "xterm-256color", "SHELL": os.Getenv("SHELL")},
+	})
+	if _, err := file.Write(append(header, '\n')); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot write recording: %w", err)
+	}
+
+	slog.Info("[Recording] Started", "path", path, "input", input)
+	return &Recorder{file: file, path: path, input: input, started: now}, nil
+}
+
+// createRecordingFile creates <base>.cast in dir, or <base>-2.cast and so on
+// when sessions started within the same second
+func createRecordingFile(dir, base string) (*os.File, string, error) {
+	for n := 1; ; n++ {
+		name := base + ".cast"
+		if n > 1 {
+			name = fmt.Sprintf("%s-%d.cast", base, n)
+		}
+		path := filepath.Join(dir, name)
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			return file, path, nil
+		}
+		if !os.IsExist(err) || n >= 100 {
+			return nil, "", err
+		}
+	}
+}
+
+// Path returns the recording's file path
+func (r *Recorder) Path() string {
+	return r.path
+}
+
+// Output records terminal output
+func (r *Recorder) Output(data []byte) {
+	r.event("o", string(data))
+}
+
+// Input records keystrokes, if enabled
+func (r *Recorder) Input(data []byte) {
+	if r.input {
+		r.event("i", string(data))
+	}
+}
+
+// Resize records a terminal size change
+func (r *Recorder) Resize(cols, rows int) {
+	r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+func (r *Recorder) event(kind, data string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.file == nil {
+		return
+	}
+	elapsed := math.Round(time.Since(r.started).Seconds()*1e6) / 1e6
+	line, _ := json.Marshal([]interface{}{elapsed, kind, data})
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		// A full disk shouldn't take the terminal down with it
+		slog.Error("[Recording] Write failed, stopping", "path", r.path, "error", err)
+		r.file.Close()
+		r.file = nil
+	}
+}
+
+// Close finishes the recording
+func (r *Recorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	slog.Info("[Recording] Stopped", "path", r.path)
+	return err
+}
+
+// runReplay implements `gemini-browser-host replay [-speed N] [-max-idle S] file.cast`
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	speed := fs.Float64("speed", 1, "Playback speed multiplier")
+	maxIdle := fs.Float64("max-idle", 2, "Cap pauses at this many seconds (0: no cap)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gemini-browser-host replay [-speed N] [-max-idle S] <file.cast>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 || *speed <= 0 {
+		fs.Usage()
+		return 2
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer file.Close()
+
+	if err := replayCast(file, os.Stdout, *speed, *maxIdle); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// replayCast writes the output events of an asciicast v2 stream to w with
+// their original timing, divided by speed
+func replayCast(r io.Reader, w io.Writer, speed, maxIdle float64) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !scanner.Scan() {
+		return fmt.Errorf("empty recording")
+	}
+	var header castHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Version != 2 {
+		return fmt.Errorf("not an asciicast v2 recording")
+	}
+
+	last := 0.0
+	for line := 2; scanner.Scan(); line++ {
+		var event []interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil || len(event) != 3 {
+			return fmt.Errorf("line %d: invalid event", line)
+		}
+		at, _ := event[0].(float64)
+		kind, _ := event[1].(string)
+		data, _ := event[2].(string)
+
+		pause := at - last
+		if maxIdle > 0 && pause > maxIdle {
+			pause = maxIdle
+		}
+		if pause > 0 {
+			time.Sleep(time.Duration(pause / speed * float64(time.Second)))
+		}
+		last = at
+
+		if kind == "o" {
+			if _, err := io.WriteString(w, data); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,260 @@
+// Host Registry
+//
+// Each native host (one per Chrome profile or Chromium browser with the
+// extension) listens on its own socket in a per-user registry directory and
+// describes itself in a JSON file next to it. The MCP server lists the
+// registry to find every running host and lets the agent pick one. The
+// first host also answers on the legacy /tmp/gemini-browser.sock path, for
+// MCP servers that predate the registry; later hosts leave it alone.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RegistryDir returns the directory holding the hosts' sockets and entries.
+// It is under /tmp on every platform, not os.TempDir(): on macOS $TMPDIR
+// differs between a host launched by Chrome and an MCP server launched
+// from a shell.
+func RegistryDir() string {
+	return filepath.Join("/tmp", fmt.Sprintf("gemini-browser-%d", os.Getuid()))
+}
+
+// legacyLockName is the lock file in the registry serializing hosts that
+// claim the legacy socket
+const legacyLockName = "legacy.lock"
+
+// A host registers before its socket listens, so an entry whose socket
+// refuses connections is only removed once it is older than this
+const registryStartupGrace = 10 * time.Second
+
+// HostEntry describes a running native host
+type HostEntry struct {
+	// Id is the extension's instanceId once it has said hello (stable
+	// across restarts of the host), otherwise pid-<pid>
+	Id               string    `json:"id"`
+	Browser          string    `json:"browser,omitempty"`
+	ExtensionVersion string    `json:"extensionVersion,omitempty"`
+	Pid              int       `json:"pid"`
+	Socket           string    `json:"socket"`
+	StartedAt        time.Time `json:"startedAt"`
+	// Legacy is set in listings for the host answering on SocketPath
+	Legacy bool `json:"legacy,omitempty"`
+}
+
+// Matches reports whether name selects this host: its id, browser name or
+// pid, ignoring case
+func (e HostEntry) Matches(name string) bool {
+	name = strings.TrimSpace(name)
+	return strings.EqualFold(name, e.Id) ||
+		strings.EqualFold(name, e.Browser) ||
+		name == fmt.Sprint(e.Pid)
+}
+
+// HostRegistration is this host's entry in the registry
+type HostRegistration struct {
+	entry HostEntry
+	path  string
+	mutex sync.Mutex
+}
+
+// RegisterHost creates the registry entry and picks the socket path for
+// this host
+func RegisterHost() (*HostRegistration, error) {
+	dir := RegistryDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("cannot create registry directory: %w", err)
+	}
+	// Shared /tmp: don't use a directory someone else prepared
+	info, err := os.Lstat(dir)
+	if err != nil || !info.IsDir() || info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("registry directory %s is not a private directory", dir)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); !ok || int(stat.Uid) != os.Getuid() {
+		return nil, fmt.Errorf("registry directory %s is owned by another user", dir)
+	}
+
+	pid := os.Getpid()
+	r := &HostRegistration{
+		entry: HostEntry{
+			Id:        fmt.Sprintf("pid-%d", pid),
+			Pid:       pid,
+			Socket:    filepath.Join(dir, fmt.Sprintf("%d.sock", pid)),
+			StartedAt: time.Now(),
+		},
+		path: filepath.Join(dir, fmt.Sprintf("%d.json", pid)),
+	}
+	if err := r.save(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SocketPath returns where this host listens
+func (r *HostRegistration) SocketPath() string {
+	return r.entry.Socket
+}
+
+// Update records who is on the other end once the extension says hello
+func (r *HostRegistration) Update(hello *HelloMessage) {
+	r.mutex.Lock()
+	if hello.InstanceId != "" {
+		r.entry.Id = hello.InstanceId
+	}
+	r.entry.Browser = hello.Browser
+	r.entry.ExtensionVersion = hello.Version
+	r.mutex.Unlock()
+
+	if err := r.save(); err != nil {
+		slog.Warn("[Registry] Failed to update entry", "error", err)
+	}
+}
+
+func (r *HostRegistration) save() error {
+	r.mutex.Lock()
+	data, err := json.MarshalIndent(r.entry, "", "  ")
+	r.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(r.path, data, true)
+}
+
+// ClaimLegacySocket points SocketPath at this host's socket unless another
+// live host already answers there. Hosts starting together take turns, and
+// the link is replaced in one rename, so clients never find it missing.
+func (r *HostRegistration) ClaimLegacySocket() {
+	unlock, err := r.lockLegacy()
+	if err != nil {
+		slog.Warn("[Registry] Failed to claim legacy socket", "path", SocketPath, "error", err)
+		return
+	}
+	defer unlock()
+
+	if conn, err := net.DialTimeout("unix", SocketPath, time.Second); err == nil {
+		conn.Close()
+		slog.Info("[Registry] Legacy socket belongs to another host", "path", SocketPath)
+		return
+	}
+	temp := fmt.Sprintf("%s.%d", SocketPath, r.entry.Pid)
+	os.Remove(temp)
+	if err := os.Symlink(r.entry.Socket, temp); err != nil {
+		slog.Warn("[Registry] Failed to claim legacy socket", "path", SocketPath, "error", err)
+		return
+	}
+	if err := os.Rename(temp, SocketPath); err != nil {
+		os.Remove(temp)
+		slog.Warn("[Registry] Failed to claim legacy socket", "path", SocketPath, "error", err)
+		return
+	}
+	slog.Info("[Registry] Serving legacy socket", "path", SocketPath)
+}
+
+// lockLegacy takes the lock held while the legacy socket is claimed or
+// released
+func (r *HostRegistration) lockLegacy() (unlock func(), err error) {
+	file, err := os.OpenFile(filepath.Join(filepath.Dir(r.path), legacyLockName), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, err
+	}
+	// Closing releases the lock
+	return func() { file.Close() }, nil
+}
+
+// Close removes this host's entry, and the legacy socket if it is ours
+func (r *HostRegistration) Close() {
+	if unlock, err := r.lockLegacy(); err == nil {
+		defer unlock()
+	}
+	if target, err := os.Readlink(SocketPath); err == nil && target == r.entry.Socket {
+		os.Remove(SocketPath)
+	}
+	os.Remove(r.path)
+}
+
+// ListHosts returns the hosts answering on their sockets, oldest first, and
+// removes entries left behind by hosts that died
+func ListHosts() []HostEntry {
+	dir := RegistryDir()
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	legacy, _ := os.Readlink(SocketPath)
+
+	var hosts []HostEntry
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var entry HostEntry
+		if err := json.Unmarshal(data, &entry); err != nil || entry.Pid <= 0 {
+			continue
+		}
+		if !hostAlive(entry) {
+			if time.Since(entry.StartedAt) > registryStartupGrace {
+				slog.Debug("[Registry] Removing stale entry", "file", file)
+				os.Remove(file)
+				os.Remove(entry.Socket)
+			}
+			continue
+		}
+		entry.Legacy = entry.Socket == legacy
+		hosts = append(hosts, entry)
+	}
+
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].StartedAt.Before(hosts[j].StartedAt)
+	})
+	return hosts
+}
+
+// hostAlive reports whether entry's process exists and its socket accepts
+// connections. The pid alone can't tell: it may have been reused after the
+// host died.
+func hostAlive(entry HostEntry) bool {
+	if err := syscall.Kill(entry.Pid, 0); err != nil && err != syscall.EPERM {
+		return false
+	}
+	conn, err := net.DialTimeout("unix", entry.Socket, 500*time.Millisecond)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// findHost picks the host for name, or the default one when name is empty:
+// the only host, else the one on the legacy socket, else the oldest
+func findHost(hosts []HostEntry, name string) (HostEntry, error) {
+	if name != "" {
+		for _, host := range hosts {
+			if host.Matches(name) {
+				return host, nil
+			}
+		}
+		return HostEntry{}, fmt.Errorf("no running browser matches %q. Use list_browsers to see them", name)
+	}
+	if len(hosts) == 0 {
+		return HostEntry{}, fmt.Errorf("no browser is connected. Make sure the Chrome extension is open")
+	}
+	for _, host := range hosts {
+		if host.Legacy {
+			return host, nil
+		}
+	}
+	return hosts[0], nil
+}
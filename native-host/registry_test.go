@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHostAlive(t *testing.T) {
+	dir := t.TempDir()
+	listening := filepath.Join(dir, "listening.sock")
+	ln, err := net.Listen("unix", listening)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// A socket file nobody listens on, as left by a host that was killed
+	closed := filepath.Join(dir, "closed.sock")
+	dead, err := net.Listen("unix", closed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead.(*net.UnixListener).SetUnlinkOnClose(false)
+	dead.Close()
+
+	tests := []struct {
+		name  string
+		entry HostEntry
+		want  bool
+	}{
+		{"live host", HostEntry{Pid: os.Getpid(), Socket: listening}, true},
+		{"socket refuses connections", HostEntry{Pid: os.Getpid(), Socket: closed}, false},
+		{"socket missing", HostEntry{Pid: os.Getpid(), Socket: filepath.Join(dir, "missing.sock")}, false},
+		{"process gone", HostEntry{Pid: 1 << 22, Socket: listening}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hostAlive(tt.entry); got != tt.want {
+				t.Errorf("hostAlive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
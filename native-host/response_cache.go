@@ -0,0 +1,238 @@
+// Response Cache
+//
+// Caches the results of read-only browser actions (page text, DOM,
+// inspect_page) so an agent re-reading an unchanged page doesn't pay for a
+// Chrome round trip each time. Entries are keyed on the tab the read
+// targets, its URL and its page token (bumped by the extension when the
+// DOM of a page it was asked to watch changes) along with the action and
+// its parameters, and expire after a per-action TTL. Navigation,
+// page-change and tab-closed events drop a tab's entries; a noCache
+// parameter skips the cache.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// CacheConfig holds the cache section of config.json
+type CacheConfig struct {
+	Enabled bool `json:"enabled"`
+	// TTLSeconds per action; actions not listed (or 0) are never cached
+	TTLSeconds map[string]int `json:"ttlSeconds"`
+	MaxEntries int            `json:"maxEntries"`
+}
+
+// DefaultCacheConfig caches the page readers for up to a minute
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		Enabled: true,
+		TTLSeconds: map[string]int{
+			"getPageText": 60,
+			"getDom":      30,
+			"inspectPage": 60,
+		},
+		MaxEntries: 100,
+	}
+}
+
+// pageChangingActions may change the page without the extension noticing
+// in time, so they drop their target tab's entries
+var pageChangingActions = map[string]bool{
+	"executeScript": true,
+	"modifyDom":     true,
+}
+
+type cacheEntry struct {
+	tabId   int
+	resp    *BrowserResponse
+	expires time.Time
+}
+
+// ResponseCache holds read-only responses for the pages Chrome reported
+type ResponseCache struct {
+	config CacheConfig
+	// tokens holds the last page token per tab, until it navigates or closes
+	tokens  map[int]string
+	entries map[string]*cacheEntry
+	// generation changes with every page change, so a response that was in
+	// flight meanwhile isn't stored
+	generation int
+	hits       int
+	misses     int
+	mutex      sync.Mutex
+}
+
+// NewResponseCache creates an empty cache
+func NewResponseCache(config CacheConfig) *ResponseCache {
+	return &ResponseCache{
+		config:  config,
+		tokens:  make(map[int]string),
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+// Cacheable reports whether responses to action are cached
+func (c *ResponseCache) Cacheable(action string) bool {
+	return c.config.Enabled && c.config.TTLSeconds[action] > 0
+}
+
+// Key returns the cache key for an action on the tab it targets, or ""
+// when the action isn't cached, along with the generation to pass to Put
+func (c *ResponseCache) Key(action string, params interface{}, tab PolicyTarget) (string, int) {
+	if !c.Cacheable(action) || tab.TabId == 0 {
+		return "", 0
+	}
+
+	// noCache only affects the lookup, not what is fetched, and the pinned
+	// tab is part of the key already
+	p, _ := params.(map[string]interface{})
+	keyed := make(map[string]interface{}, len(p))
+	for k, v := range p {
+		if k != "noCache" && k != "targetTabId" && k != "targetUrl" {
+			keyed[k] = v
+		}
+	}
+	paramsJSON, err := json.Marshal(keyed)
+	if err != nil {
+		return "", 0
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := fmt.Sprintf("%d|%s|%s|%s|%s", tab.TabId, tab.URL, c.tokens[tab.TabId], action, paramsJSON)
+	return key, c.generation
+}
+
+// Get returns a live entry
+func (c *ResponseCache) Get(key string) *BrowserResponse {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[key]
+	if ok && time.Now().Before(entry.expires) {
+		c.hits++
+		return entry.resp
+	}
+	delete(c.entries, key)
+	c.misses++
+	return nil
+}
+
+// Put stores a successful response for tabId, unless a page changed since Key
+func (c *ResponseCache) Put(key string, generation int, tabId int, action string, resp *BrowserResponse) {
+	if key == "" || resp == nil || !resp.Success {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if generation != c.generation || c.config.MaxEntries <= 0 {
+		return
+	}
+
+	now := time.Now()
+	if len(c.entries) >= c.config.MaxEntries {
+		c.evictLocked(now)
+	}
+	ttl := time.Duration(c.config.TTLSeconds[action]) * time.Second
+	c.entries[key] = &cacheEntry{tabId: tabId, resp: resp, expires: now.Add(ttl)}
+}
+
+// evictLocked drops expired entries, or the one closest to expiry when
+// none has expired
+func (c *ResponseCache) evictLocked(now time.Time) {
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	if len(c.entries) < c.config.MaxEntries {
+		return
+	}
+
+	var soonest string
+	for key, entry := range c.entries {
+		if soonest == "" || entry.expires.Before(c.entries[soonest].expires) {
+			soonest = key
+		}
+	}
+	delete(c.entries, soonest)
+}
+
+// AfterAction drops the entries of tabId, the tab an action that may have
+// changed the page ran on, or every entry when the tab isn't known
+func (c *ResponseCache) AfterAction(action string, tabId int) {
+	if !pageChangingActions[action] {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if tabId == 0 {
+		c.generation++
+		clear(c.entries)
+		return
+	}
+	c.dropTabLocked(tabId)
+}
+
+// HandleEvent follows the page tokens of tabs and drops the entries of
+// tabs that navigate, change or close
+func (c *ResponseCache) HandleEvent(topic string, data interface{}) {
+	d, _ := data.(map[string]interface{})
+	id, ok := d["tabId"].(float64)
+	if !ok {
+		return
+	}
+	tabId := int(id)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	switch topic {
+	case EventTab:
+		// Switching tabs keeps their entries; they are keyed by tab
+		if closed, _ := d["closed"].(bool); closed {
+			delete(c.tokens, tabId)
+			c.dropTabLocked(tabId)
+		}
+	case EventNavigation:
+		delete(c.tokens, tabId)
+		c.dropTabLocked(tabId)
+	case EventPage:
+		token, _ := d["token"].(float64)
+		c.tokens[tabId] = fmt.Sprintf("%.0f", token)
+		c.dropTabLocked(tabId)
+	}
+}
+
+// dropTabLocked removes a tab's entries
+func (c *ResponseCache) dropTabLocked(tabId int) {
+	c.generation++
+	dropped := 0
+	for key, entry := range c.entries {
+		if entry.tabId == tabId {
+			delete(c.entries, key)
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		slog.Debug("[Cache] Invalidated", "tabId", tabId, "entries", dropped)
+	}
+}
+
+// Stats reports the cache size and hit rate, for the status API
+func (c *ResponseCache) Stats() map[string]interface{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return map[string]interface{}{
+		"enabled": c.config.Enabled,
+		"entries": len(c.entries),
+		"hits":    c.hits,
+		"misses":  c.misses,
+	}
+}
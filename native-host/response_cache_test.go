@@ -0,0 +1,195 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResponseCache(t *testing.T) {
+	tab := PolicyTarget{TabId: 1, URL: "https://example.com/"}
+	otherTab := PolicyTarget{TabId: 2, URL: "https://example.com/"}
+	params := map[string]interface{}{"selector": "main"}
+
+	tests := []struct {
+		name string
+		// between is run after the response is stored and before the lookup
+		between func(c *ResponseCache)
+		// lookup is the read looked up afterwards (default: the same read)
+		lookupTab    *PolicyTarget
+		lookupParams map[string]interface{}
+		wantHit      bool
+	}{
+		{name: "same read hits", wantHit: true},
+		{
+			name:         "noCache is not part of the key",
+			lookupParams: map[string]interface{}{"selector": "main", "noCache": true},
+			wantHit:      true,
+		},
+		{
+			name:         "pinned tab is not part of the params key",
+			lookupParams: map[string]interface{}{"selector": "main", "targetTabId": 1, "targetUrl": tab.URL},
+			wantHit:      true,
+		},
+		{
+			name:         "other params miss",
+			lookupParams: map[string]interface{}{"selector": "nav"},
+		},
+		{name: "other tab misses", lookupTab: &otherTab},
+		{
+			name:      "other URL misses",
+			lookupTab: &PolicyTarget{TabId: 1, URL: "https://example.com/other"},
+		},
+		{
+			name: "expired entry misses",
+			between: func(c *ResponseCache) {
+				for _, entry := range c.entries {
+					entry.expires = time.Now().Add(-time.Second)
+				}
+			},
+		},
+		{
+			name: "activating another tab keeps entries",
+			between: func(c *ResponseCache) {
+				c.HandleEvent(EventTab, map[string]interface{}{"tabId": 2.0, "url": otherTab.URL})
+			},
+			wantHit: true,
+		},
+		{
+			name: "navigation drops the tab's entries",
+			between: func(c *ResponseCache) {
+				c.HandleEvent(EventNavigation, map[string]interface{}{"tabId": 1.0, "url": tab.URL})
+			},
+		},
+		{
+			name: "new page token drops the tab's entries",
+			between: func(c *ResponseCache) {
+				c.HandleEvent(EventPage, map[string]interface{}{"tabId": 1.0, "url": tab.URL, "token": 42.0})
+			},
+		},
+		{
+			name: "page change on another tab keeps entries",
+			between: func(c *ResponseCache) {
+				c.HandleEvent(EventPage, map[string]interface{}{"tabId": 2.0, "url": otherTab.URL, "token": 42.0})
+			},
+			wantHit: true,
+		},
+		{
+			name: "closing the tab drops its entries",
+			between: func(c *ResponseCache) {
+				c.HandleEvent(EventTab, map[string]interface{}{"tabId": 1.0, "closed": true})
+			},
+		},
+		{
+			name:    "script on the tab drops its entries",
+			between: func(c *ResponseCache) { c.AfterAction("executeScript", 1) },
+		},
+		{
+			name:    "script on another tab keeps entries",
+			between: func(c *ResponseCache) { c.AfterAction("modifyDom", 2) },
+			wantHit: true,
+		},
+		{
+			name:    "script on an unknown tab drops everything",
+			between: func(c *ResponseCache) { c.AfterAction("executeScript", 0) },
+		},
+		{
+			name:    "read-only action keeps entries",
+			between: func(c *ResponseCache) { c.AfterAction("getUrl", 1) },
+			wantHit: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewResponseCache(DefaultCacheConfig())
+			key, generation := c.Key("getPageText", params, tab)
+			if key == "" {
+				t.Fatal("getPageText is not cached")
+			}
+			c.Put(key, generation, tab.TabId, "getPageText", &BrowserResponse{Success: true, Data: "page"})
+
+			if tt.between != nil {
+				tt.between(c)
+			}
+
+			lookupTab, lookupParams := tab, params
+			if tt.lookupTab != nil {
+				lookupTab = *tt.lookupTab
+			}
+			if tt.lookupParams != nil {
+				lookupParams = tt.lookupParams
+			}
+			key, _ = c.Key("getPageText", lookupParams, lookupTab)
+			if hit := c.Get(key) != nil; hit != tt.wantHit {
+				t.Errorf("hit = %v, want %v", hit, tt.wantHit)
+			}
+		})
+	}
+}
+
+func TestResponseCacheNotStored(t *testing.T) {
+	tab := PolicyTarget{TabId: 1, URL: "https://example.com/"}
+	ok := &BrowserResponse{Success: true}
+
+	tests := []struct {
+		name   string
+		config CacheConfig
+		action string
+		// during runs between Key and Put, while the read is in flight
+		during func(c *ResponseCache)
+		resp   *BrowserResponse
+	}{
+		{
+			name:   "page changed while the read was in flight",
+			action: "getPageText",
+			during: func(c *ResponseCache) {
+				c.HandleEvent(EventPage, map[string]interface{}{"tabId": 1.0, "token": 7.0})
+			},
+			resp: ok,
+		},
+		{
+			name:   "script ran on another tab meanwhile",
+			action: "getPageText",
+			during: func(c *ResponseCache) { c.AfterAction("executeScript", 2) },
+			resp:   ok,
+		},
+		{name: "failed response", action: "getPageText", resp: &BrowserResponse{Error: "boom"}},
+		{name: "action without a TTL", action: "getUrl", resp: ok},
+		{name: "cache disabled", config: CacheConfig{TTLSeconds: map[string]int{"getPageText": 60}, MaxEntries: 10}, action: "getPageText", resp: ok},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			if config.TTLSeconds == nil {
+				config = DefaultCacheConfig()
+			}
+			c := NewResponseCache(config)
+			key, generation := c.Key(tt.action, nil, tab)
+			if tt.during != nil {
+				tt.during(c)
+			}
+			c.Put(key, generation, tab.TabId, tt.action, tt.resp)
+
+			key, _ = c.Key(tt.action, nil, tab)
+			if len(c.entries) != 0 || (key != "" && c.Get(key) != nil) {
+				t.Error("response was stored")
+			}
+		})
+	}
+}
+
+func TestResponseCacheMaxEntries(t *testing.T) {
+	config := DefaultCacheConfig()
+	config.MaxEntries = 2
+	c := NewResponseCache(config)
+
+	for id := 1; id <= 3; id++ {
+		tab := PolicyTarget{TabId: id, URL: "https://example.com/"}
+		key, generation := c.Key("getDom", nil, tab)
+		c.Put(key, generation, id, "getDom", &BrowserResponse{Success: true})
+	}
+	if len(c.entries) != 2 {
+		t.Errorf("%d entries, want 2", len(c.entries))
+	}
+}
@@ -0,0 +1,106 @@
+// Restart Policy
+//
+// Decides whether the terminal process is started again after it exits.
+// Restarts back off exponentially, and a process that keeps crashing is
+// left stopped so the side panel isn't flooded with failing sessions.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Restart modes
+const (
+	RestartNever     = "never"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+// RestartPolicy holds terminal.restart in config.json
+type RestartPolicy struct {
+	// Mode is never, on-failure (non-zero exit or signal) or always
+	Mode string `json:"mode"`
+	// MaxRestarts within WindowSeconds before giving up
+	MaxRestarts   int `json:"maxRestarts"`
+	WindowSeconds int `json:"windowSeconds"`
+	// Backoff doubles from InitialBackoffMs up to MaxBackoffMs
+	InitialBackoffMs int `json:"initialBackoffMs"`
+	MaxBackoffMs     int `json:"maxBackoffMs"`
+}
+
+// DefaultRestartPolicy leaves exited sessions stopped until the user restarts them
+func DefaultRestartPolicy() RestartPolicy {
+	return RestartPolicy{
+		Mode:             RestartNever,
+		MaxRestarts:      5,
+		WindowSeconds:    60,
+		InitialBackoffMs: 1000,
+		MaxBackoffMs:     30000,
+	}
+}
+
+// restartTracker applies a RestartPolicy to a series of exits
+type restartTracker struct {
+	policy   RestartPolicy
+	restarts []time.Time
+	mutex    sync.Mutex
+}
+
+func newRestartTracker(policy RestartPolicy) *restartTracker {
+	return &restartTracker{policy: policy}
+}
+
+// reset forgets earlier restarts, e.g. after the user restarted by hand
+func (t *restartTracker) reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.restarts = nil
+}
+
+// next returns how long to wait before restarting after exit. ok is false
+// when the session should stay stopped; reason then says why if it is
+// worth telling the user.
+func (t *restartTracker) next(exit PTYExit) (delay time.Duration, ok bool, reason string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	switch t.policy.Mode {
+	case RestartAlways:
+	case RestartOnFailure:
+		if !exit.Failed() {
+			return 0, false, ""
+		}
+	default:
+		return 0, false, ""
+	}
+
+	// Only restarts inside the window count towards the crash loop
+	now := time.Now()
+	window := time.Duration(t.policy.WindowSeconds) * time.Second
+	recent := t.restarts[:0]
+	for _, at := range t.restarts {
+		if now.Sub(at) < window {
+			recent = append(recent, at)
+		}
+	}
+	t.restarts = recent
+
+	if t.policy.MaxRestarts > 0 && len(t.restarts) >= t.policy.MaxRestarts {
+		return 0, false, fmt.Sprintf("restarted %d times in %ds, giving up", len(t.restarts), t.policy.WindowSeconds)
+	}
+
+	delay = time.Duration(t.policy.InitialBackoffMs) * time.Millisecond
+	maxDelay := time.Duration(t.policy.MaxBackoffMs) * time.Millisecond
+	for i := 0; i < len(t.restarts) && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+
+	t.restarts = append(t.restarts, now)
+	return delay, true, ""
+}
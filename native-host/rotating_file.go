@@ -0,0 +1,156 @@
+// Rotating File
+//
+// An append-only file writer that rotates by size, keeping a fixed
+// number of numbered backups (file.1 is the most recent). Several processes
+// may share the file (every native host writes the same host and audit
+// logs): writes and rotations are serialized with a lock file next to it.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// RotatingFile is an io.Writer that rotates the underlying file by size
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+	// lockFile is locked around each write; nil if it couldn't be opened
+	lockFile *os.File
+	mutex    sync.Mutex
+}
+
+// NewRotatingFile opens (or creates) path for appending
+func NewRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	r := &RotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	if lockFile, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644); err == nil {
+		r.lockFile = lockFile
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if it would exceed the size limit
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.file == nil {
+		return 0, fmt.Errorf("file closed: %s", r.path)
+	}
+
+	if r.lockFile != nil && syscall.Flock(int(r.lockFile.Fd()), syscall.LOCK_EX) == nil {
+		defer syscall.Flock(int(r.lockFile.Fd()), syscall.LOCK_UN)
+	}
+	if err := r.sync(); err != nil {
+		return 0, err
+	}
+
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// sync catches up with other processes writing the file: reopens it if one
+// of them rotated it away, and refreshes its size. Caller must hold the
+// mutex and the lock file.
+func (r *RotatingFile) sync() error {
+	current, err := r.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(r.path); err != nil || !os.SameFile(info, current) {
+		r.file.Close()
+		r.file = nil
+		return r.open()
+	}
+	r.size = current.Size()
+	return nil
+}
+
+// rotate shifts file.N-1 -> file.N ... file -> file.1. Caller must hold the mutex.
+func (r *RotatingFile) rotate() error {
+	r.file.Close()
+	r.file = nil
+
+	os.Remove(r.backupPath(r.maxBackups))
+	for i := r.maxBackups - 1; i >= 1; i-- {
+		os.Rename(r.backupPath(i), r.backupPath(i+1))
+	}
+	if r.maxBackups > 0 {
+		os.Rename(r.path, r.backupPath(1))
+	} else {
+		os.Remove(r.path)
+	}
+
+	return r.open()
+}
+
+func (r *RotatingFile) backupPath(n int) string {
+	return fmt.Sprintf("%s.%d", r.path, n)
+}
+
+// Files returns the current file and existing backups, newest first
+func (r *RotatingFile) Files() []string {
+	files := []string{r.path}
+	for i := 1; i <= r.maxBackups; i++ {
+		if _, err := os.Stat(r.backupPath(i)); err == nil {
+			files = append(files, r.backupPath(i))
+		}
+	}
+	return files
+}
+
+// Close closes the underlying file
+func (r *RotatingFile) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	if r.lockFile != nil {
+		r.lockFile.Close()
+		r.lockFile = nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotatingFileShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	// Two hosts writing the same log
+	first, err := NewRotatingFile(path, 100, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := NewRotatingFile(path, 100, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	for i := 0; i < 40; i++ {
+		w := first
+		if i%3 == 0 {
+			w = second
+		}
+		if _, err := fmt.Fprintf(w, "entry %02d\n", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var lines int
+	for _, file := range first.Files() {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > 100 {
+			t.Errorf("%s has %d bytes, want at most 100", file, len(data))
+		}
+		lines += bytes.Count(data, []byte("\n"))
+	}
+	if lines != 40 {
+		t.Errorf("%d entries across the files, want 40", lines)
+	}
+}
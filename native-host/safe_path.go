@@ -0,0 +1,131 @@
+// Safe Output Paths
+//
+// Output-path policy for files written on behalf of the model.
+// Filenames are confined to a base directory, symlinks are never
+// followed, and writes are atomic (temp file + rename) with overwrite
+// protection unless explicitly requested.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrFileExists is returned when the target exists and overwrite is not allowed
+var ErrFileExists = errors.New("file already exists")
+
+// resolveOutputPath validates a caller-supplied filename and returns its
+// absolute path inside baseDir. Only plain filenames are accepted: no
+// directories, no absolute paths, no parent references, no hidden files.
+func resolveOutputPath(baseDir, name string) (string, error) {
+	if strings.TrimSpace(name) == "" {
+		return "", fmt.Errorf("filename is empty")
+	}
+	if strings.ContainsRune(name, 0) {
+		return "", fmt.Errorf("filename contains a NUL byte")
+	}
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "~") {
+		return "", fmt.Errorf("filename must be relative: %q", name)
+	}
+
+	// Treat backslashes as separators too so Windows-style names can't sneak through
+	cleaned := filepath.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if cleaned != filepath.Base(cleaned) {
+		return "", fmt.Errorf("filename must not contain directories: %q", name)
+	}
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, ".") {
+		return "", fmt.Errorf("invalid filename: %q", name)
+	}
+
+	base, err := filepath.Abs(baseDir)
+	if err != nil {
+		return "", err
+	}
+	full := filepath.Join(base, cleaned)
+
+	// Defense in depth: the joined path must still be directly inside base
+	if filepath.Dir(full) != base {
+		return "", fmt.Errorf("filename escapes output directory: %q", name)
+	}
+
+	return full, nil
+}
+
+// ensureOutputDir creates dir if needed and refuses to use it if it is a symlink
+func ensureOutputDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("refusing to write into symlinked directory: %s", dir)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory: %s", dir)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to path via a temp file in the same directory.
+// Existing symlinks and non-regular files are never written through. Without
+// overwrite, an existing target yields ErrFileExists.
+func writeFileAtomic(path string, data []byte, overwrite bool) error {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to write through symlink: %s", path)
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("refusing to replace non-regular file: %s", path)
+		}
+		if !overwrite {
+			return fmt.Errorf("%w: %s", ErrFileExists, path)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
+
+	if overwrite {
+		// rename replaces the directory entry itself, never a symlink target
+		return os.Rename(tmpPath, path)
+	}
+
+	// link fails if the target appeared since the check above, so we never clobber
+	if err := os.Link(tmpPath, path); err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("%w: %s", ErrFileExists, path)
+		}
+		return err
+	}
+	return nil
+}
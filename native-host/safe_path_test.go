@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveOutputPath(t *testing.T) {
+	base := t.TempDir()
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"plain name", "page.html", "page.html", false},
+		{"name with spaces", "my page.txt", "my page.txt", false},
+		{"empty", "", "", true},
+		{"whitespace only", "   ", "", true},
+		{"parent traversal", "../evil.txt", "", true},
+		{"nested traversal", "a/../../evil.txt", "", true},
+		{"bare parent", "..", "", true},
+		{"current dir", ".", "", true},
+		{"subdirectory", "sub/page.html", "", true},
+		{"absolute path", "/etc/passwd", "", true},
+		{"home directory", "~/.bashrc", "", true},
+		{"home of another user", "~root", "", true},
+		{"NUL byte", "page\x00.html", "", true},
+		{"backslash traversal", "..\\evil.txt", "", true},
+		{"backslash directory", "sub\\page.html", "", true},
+		{"dotfile", ".bashrc", "", true},
+		{"hidden temp file", ".page.html.tmp-1", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveOutputPath(base, tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("resolveOutputPath(%q) = %q, want error", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveOutputPath(%q) failed: %v", tt.input, err)
+			}
+			if want := filepath.Join(base, tt.want); got != want {
+				t.Errorf("resolveOutputPath(%q) = %q, want %q", tt.input, got, want)
+			}
+		})
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	t.Run("creates file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "out.txt")
+		if err := writeFileAtomic(path, []byte("hello"), false); err != nil {
+			t.Fatal(err)
+		}
+		assertFile(t, path, "hello")
+	})
+
+	t.Run("does not clobber existing file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "out.txt")
+		os.WriteFile(path, []byte("original"), 0644)
+
+		err := writeFileAtomic(path, []byte("new"), false)
+		if !errors.Is(err, ErrFileExists) {
+			t.Fatalf("got %v, want ErrFileExists", err)
+		}
+		assertFile(t, path, "original")
+	})
+
+	t.Run("overwrites when asked", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "out.txt")
+		os.WriteFile(path, []byte("original"), 0644)
+
+		if err := writeFileAtomic(path, []byte("new"), true); err != nil {
+			t.Fatal(err)
+		}
+		assertFile(t, path, "new")
+	})
+
+	for _, overwrite := range []bool{false, true} {
+		name := "refuses planted symlink"
+		if overwrite {
+			name += " with overwrite"
+		}
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			target := filepath.Join(dir, "target.txt")
+			os.WriteFile(target, []byte("secret"), 0644)
+			path := filepath.Join(dir, "out.txt")
+			if err := os.Symlink(target, path); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := writeFileAtomic(path, []byte("new"), overwrite); err == nil {
+				t.Fatal("wrote through a symlink")
+			}
+			assertFile(t, target, "secret")
+			if info, err := os.Lstat(path); err != nil || info.Mode()&os.ModeSymlink == 0 {
+				t.Errorf("symlink was replaced")
+			}
+		})
+	}
+
+	t.Run("refuses dangling symlink", func(t *testing.T) {
+		dir := t.TempDir()
+		target := filepath.Join(dir, "missing.txt")
+		path := filepath.Join(dir, "out.txt")
+		if err := os.Symlink(target, path); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := writeFileAtomic(path, []byte("new"), false); err == nil {
+			t.Fatal("wrote through a dangling symlink")
+		}
+		if _, err := os.Lstat(target); !os.IsNotExist(err) {
+			t.Errorf("symlink target was created")
+		}
+	})
+
+	t.Run("leaves no temp files", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "out.txt")
+		writeFileAtomic(path, []byte("a"), false)
+		writeFileAtomic(path, []byte("b"), false)
+
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != 1 {
+			t.Errorf("directory has %d entries, want 1", len(entries))
+		}
+	})
+}
+
+func assertFile(t *testing.T, path, want string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("%s contains %q, want %q", filepath.Base(path), data, want)
+	}
+}
@@ -0,0 +1,277 @@
+// Screenshot Processing
+//
+// Parses screenshot data URLs returned by Chrome and downscales
+// oversized images so they fit within model input limits. Go can't decode
+// WebP, so an oversized WebP capture is taken again as JPEG.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	_ "image/gif"
+)
+
+const (
+	// DefaultScreenshotMaxWidth is used when the caller does not pass maxWidth
+	DefaultScreenshotMaxWidth = 1600
+	// MaxScreenshotHeight caps tall full-page captures
+	MaxScreenshotHeight = 8000
+	// MaxScreenshotBytes is the largest encoded image returned to the model
+	MaxScreenshotBytes = 4 * 1024 * 1024
+	// DefaultScreenshotQuality matches the extension's capture quality
+	DefaultScreenshotQuality = 90
+)
+
+// errCannotDownscale is returned by fitImage for an oversized image in a
+// format Go cannot decode
+var errCannotDownscale = errors.New("image is too large and its format cannot be downscaled")
+
+// parseDataURL splits a data URL into its MIME type and decoded payload
+func parseDataURL(dataURL string) (string, []byte, error) {
+	rest, ok := strings.CutPrefix(dataURL, "data:")
+	if !ok {
+		return "", nil, fmt.Errorf("not a data URL")
+	}
+
+	meta, payload, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", nil, fmt.Errorf("malformed data URL: missing ','")
+	}
+
+	isBase64 := false
+	mimeType := ""
+	for i, part := range strings.Split(meta, ";") {
+		if i == 0 {
+			mimeType = strings.TrimSpace(part)
+			continue
+		}
+		if strings.EqualFold(part, "base64") {
+			isBase64 = true
+		}
+	}
+	if mimeType == "" {
+		mimeType = "text/plain"
+	}
+
+	if isBase64 {
+		data, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid base64 payload: %w", err)
+		}
+		return mimeType, data, nil
+	}
+
+	decoded, err := url.PathUnescape(payload)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid data URL payload: %w", err)
+	}
+	return mimeType, []byte(decoded), nil
+}
+
+// fitImage downscales an encoded image so it is at most maxWidth x maxHeight
+// and MaxScreenshotBytes. Formats Go cannot decode (e.g. WebP) are returned
+// unchanged if they already fit, otherwise errCannotDownscale.
+func fitImage(data []byte, mimeType string, maxWidth, maxHeight, quality int) ([]byte, string, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		width, height, ok := webpSize(data)
+		if !ok || len(data) > MaxScreenshotBytes ||
+			(maxWidth > 0 && width > maxWidth) || (maxHeight > 0 && height > maxHeight) {
+			slog.Info("[Screenshot] Cannot downscale", "mimeType", mimeType, "bytes", len(data), "error", err)
+			return nil, "", errCannotDownscale
+		}
+		return data, mimeType, nil
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	scale := 1.0
+	if maxWidth > 0 && width > maxWidth {
+		scale = float64(maxWidth) / float64(width)
+	}
+	if maxHeight > 0 && float64(height)*scale > float64(maxHeight) {
+		scale = float64(maxHeight) / float64(height)
+	}
+
+	if scale == 1.0 && len(data) <= MaxScreenshotBytes {
+		return data, mimeType, nil
+	}
+
+	if scale < 1.0 {
+		newWidth := max(1, int(float64(width)*scale))
+		newHeight := max(1, int(float64(height)*scale))
+		slog.Info("[Screenshot] Downscaling", "from", fmt.Sprintf("%dx%d", width, height), "to", fmt.Sprintf("%dx%d", newWidth, newHeight))
+		img = resizeImage(img, newWidth, newHeight)
+	}
+
+	out, outType, err := encodeImage(img, mimeType, quality)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Large PNGs (photos, long pages) compress far better as JPEG
+	if len(out) > MaxScreenshotBytes && outType == "image/png" {
+		out, outType, err = encodeImage(img, "image/jpeg", quality)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	return out, outType, nil
+}
+
+func encodeImage(img image.Image, mimeType string, quality int) ([]byte, string, error) {
+	var buf bytes.Buffer
+	switch mimeType {
+	case "image/jpeg":
+		if quality <= 0 || quality > 100 {
+			quality = DefaultScreenshotQuality
+		}
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, "", fmt.Errorf("failed to encode JPEG: %w", err)
+		}
+		return buf.Bytes(), "image/jpeg", nil
+	default:
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", fmt.Errorf("failed to encode PNG: %w", err)
+		}
+		return buf.Bytes(), "image/png", nil
+	}
+}
+
+// webpSize reads the dimensions from a WebP file header
+func webpSize(data []byte) (int, int, bool) {
+	if len(data) < 30 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return 0, 0, false
+	}
+	switch string(data[12:16]) {
+	case "VP8 ": // lossy: 14-bit sizes after the frame tag and start code
+		width := int(binary.LittleEndian.Uint16(data[26:28]) & 0x3fff)
+		height := int(binary.LittleEndian.Uint16(data[28:30]) & 0x3fff)
+		return width, height, true
+	case "VP8L": // lossless: two 14-bit sizes minus one after the signature
+		bits := binary.LittleEndian.Uint32(data[21:25])
+		return int(bits&0x3fff) + 1, int((bits>>14)&0x3fff) + 1, true
+	case "VP8X": // extended: 24-bit sizes minus one
+		width := int(data[24]) | int(data[25])<<8 | int(data[26])<<16
+		height := int(data[27]) | int(data[28])<<8 | int(data[29])<<16
+		return width + 1, height + 1, true
+	}
+	return 0, 0, false
+}
+
+// resizeImage scales src to width x height using area averaging, which keeps
+// text legible when shrinking screenshots
+func resizeImage(src image.Image, width, height int) image.Image {
+	rgba := image.NewRGBA(src.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), src, src.Bounds().Min, draw.Src)
+
+	srcW, srcH := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := y * srcH / height
+		y1 := max(y0+1, (y+1)*srcH/height)
+		for x := 0; x < width; x++ {
+			x0 := x * srcW / width
+			x1 := max(x0+1, (x+1)*srcW/width)
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				off := sy*rgba.Stride + x0*4
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(rgba.Pix[off])
+					g += uint32(rgba.Pix[off+1])
+					b += uint32(rgba.Pix[off+2])
+					a += uint32(rgba.Pix[off+3])
+					off += 4
+					n++
+				}
+			}
+
+			d := y*dst.Stride + x*4
+			dst.Pix[d] = uint8(r / n)
+			dst.Pix[d+1] = uint8(g / n)
+			dst.Pix[d+2] = uint8(b / n)
+			dst.Pix[d+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+func (s *MCPServer) handleScreenshot(id interface{}, args map[string]interface{}) *JSONRPCResponse {
+	mimeType, data, errResp := s.captureScreenshot(id, args)
+	if errResp != nil {
+		return errResp
+	}
+
+	maxWidth := DefaultScreenshotMaxWidth
+	if w, ok := args["maxWidth"].(float64); ok && w > 0 {
+		maxWidth = int(w)
+	}
+	quality := 0
+	if q, ok := args["quality"].(float64); ok {
+		quality = int(q)
+	}
+
+	fitted, fittedType, err := fitImage(data, mimeType, maxWidth, MaxScreenshotHeight, quality)
+	if errors.Is(err, errCannotDownscale) {
+		// Take it again in a format we can shrink
+		slog.Info("[Screenshot] Capturing oversized image again as JPEG", "mimeType", mimeType)
+		retry := make(map[string]interface{}, len(args))
+		for k, v := range args {
+			retry[k] = v
+		}
+		retry["format"] = "jpeg"
+		if mimeType, data, errResp = s.captureScreenshot(id, retry); errResp != nil {
+			return errResp
+		}
+		fitted, fittedType, err = fitImage(data, mimeType, maxWidth, MaxScreenshotHeight, quality)
+	}
+	if err != nil {
+		return s.errorResponse(id, -32000, fmt.Sprintf("Failed to process screenshot: %v", err))
+	}
+
+	return &JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type":     "image",
+					"data":     base64.StdEncoding.EncodeToString(fitted),
+					"mimeType": fittedType,
+				},
+			},
+		},
+	}
+}
+
+// captureScreenshot asks Chrome for a screenshot and decodes its data URL
+func (s *MCPServer) captureScreenshot(id interface{}, args map[string]interface{}) (string, []byte, *JSONRPCResponse) {
+	socketResp, errResp := s.browserRequest(id, "screenshot", args)
+	if errResp != nil {
+		return "", nil, errResp
+	}
+
+	dataMap, _ := socketResp.Data.(map[string]interface{})
+	dataURL, _ := dataMap["dataUrl"].(string)
+	mimeType, data, err := parseDataURL(dataURL)
+	if err != nil {
+		return "", nil, s.errorResponse(id, -32000, fmt.Sprintf("Invalid screenshot data: %v", err))
+	}
+	return mimeType, data, nil
+}
@@ -9,29 +9,50 @@ package main
 import (
 	"bufio"
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
 	"net"
 	"os"
 	"sync"
+	"time"
 )
 
+// LocalHandler serves a socket action inside the native host without Chrome
+type LocalHandler func(params interface{}) (interface{}, error)
+
 // SocketServer manages the Unix socket for MCP client connections
 type SocketServer struct {
-	path     string
-	bridge   *BrowserBridge
-	listener net.Listener
-	clients  map[net.Conn]bool
-	mutex    sync.Mutex
-	running  bool
+	path         string
+	bridge       *BrowserBridge
+	policy       *PolicyEngine
+	audit        *AuditLog
+	localActions map[string]LocalHandler
+	listener     net.Listener
+	clients      map[net.Conn]bool
+	nextClientId int
+	mutex        sync.Mutex
+	running      bool
 }
 
 // NewSocketServer creates a new socket server
-func NewSocketServer(path string, bridge *BrowserBridge) *SocketServer {
-	return &SocketServer{
-		path:    path,
-		bridge:  bridge,
-		clients: make(map[net.Conn]bool),
+func NewSocketServer(path string, bridge *BrowserBridge, policy *PolicyEngine, audit *AuditLog) *SocketServer {
+	s := &SocketServer{
+		path:         path,
+		bridge:       bridge,
+		policy:       policy,
+		audit:        audit,
+		localActions: make(map[string]LocalHandler),
+		clients:      make(map[net.Conn]bool),
+	}
+	if audit != nil {
+		s.HandleLocal("getActionHistory", audit.handleActionHistory)
 	}
+	return s
+}
+
+// HandleLocal registers an action served by the native host itself
+func (s *SocketServer) HandleLocal(action string, handler LocalHandler) {
+	s.localActions[action] = handler
 }
 
 // Start starts the socket server
@@ -49,36 +70,66 @@ func (s *SocketServer) Start() error {
 	os.Chmod(s.path, 0777)
 
 	s.running = true
-	log.Printf("[Socket] Listening on %s", s.path)
+	slog.Info("[Socket] Listening", "path", s.path)
 
 	for s.running {
 		conn, err := s.listener.Accept()
 		if err != nil {
 			if s.running {
-				log.Printf("[Socket] Accept error: %v", err)
+				slog.Error("[Socket] Accept error", "error", err)
 			}
 			continue
 		}
 
 		s.mutex.Lock()
 		s.clients[conn] = true
+		s.nextClientId++
+		clientId := fmt.Sprintf("client-%d", s.nextClientId)
 		s.mutex.Unlock()
+		hostMetrics.AddSocketClients(1)
 
-		log.Println("[Socket] MCP client connected")
-		go s.handleClient(conn)
+		slog.Info("[Socket] MCP client connected", "client", clientId)
+		go s.handleClient(conn, clientId)
 	}
 
 	return nil
 }
 
+// socketClient is one connected MCP client. Responses and pushed events are
+// written from different goroutines, so writes are serialized.
+type socketClient struct {
+	id           string
+	conn         net.Conn
+	subscription *EventSubscription
+	writeMutex   sync.Mutex
+}
+
+// send writes one JSON line to the client
+func (c *socketClient) send(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	_, err = c.conn.Write(append(data, '\n'))
+	return err
+}
+
 // handleClient handles a connected MCP client
-func (s *SocketServer) handleClient(conn net.Conn) {
+func (s *SocketServer) handleClient(conn net.Conn, clientId string) {
+	client := &socketClient{id: clientId, conn: conn}
+
 	defer func() {
+		if client.subscription != nil {
+			s.bridge.Events().Unsubscribe(client.subscription)
+		}
 		s.mutex.Lock()
 		delete(s.clients, conn)
 		s.mutex.Unlock()
+		hostMetrics.AddSocketClients(-1)
 		conn.Close()
-		log.Println("[Socket] MCP client disconnected")
+		slog.Info("[Socket] MCP client disconnected", "client", clientId)
 	}()
 
 	reader := bufio.NewReader(conn)
@@ -92,17 +143,105 @@ func (s *SocketServer) handleClient(conn net.Conn) {
 		// Parse the socket message
 		var socketMsg SocketMessage
 		if err := json.Unmarshal(line, &socketMsg); err != nil {
-			log.Printf("[Socket] Failed to parse message: %v", err)
+			slog.Warn("[Socket] Failed to parse message", "client", clientId, "error", err)
 			continue
 		}
 
-		// Handle the request
-		response := s.handleRequest(socketMsg)
+		// Handle the request. Browser requests and local actions run
+		// concurrently (replies carry the requestId), so a long command
+		// doesn't hold up the client's other requests.
+		var response SocketResponse
+		switch socketMsg.Type {
+		case "status":
+			response = SocketResponse{
+				Type:      "status",
+				RequestId: socketMsg.RequestId,
+				Success:   true,
+				Data:      s.status(),
+			}
+		case "ping":
+			// Clients check the host is still serving the socket
+			response = SocketResponse{
+				Type:      "pong",
+				RequestId: socketMsg.RequestId,
+				Success:   true,
+				Data:      map[string]interface{}{"extension": s.bridge.Liveness()},
+			}
+		case "subscribe", "unsubscribe":
+			response = s.handleSubscribe(client, socketMsg)
+		default:
+			go func(msg SocketMessage) {
+				response := s.handleRequest(msg, clientId)
+				if err := client.send(response); err != nil {
+					slog.Warn("[Socket] Failed to write response", "client", clientId, "error", err)
+				}
+			}(socketMsg)
+			continue
+		}
 
 		// Send response
-		respBytes, _ := json.Marshal(response)
-		respBytes = append(respBytes, '\n')
-		conn.Write(respBytes)
+		if err := client.send(response); err != nil {
+			slog.Warn("[Socket] Failed to write response", "client", clientId, "error", err)
+			return
+		}
+	}
+}
+
+// status reports the host metrics and which extension the host is talking to
+func (s *SocketServer) status() map[string]interface{} {
+	status := hostMetrics.Snapshot()
+	status["protocolVersion"] = ProtocolVersion
+	extension := s.bridge.Liveness()
+	if ext := s.bridge.Extension(); ext != nil {
+		extension["version"] = ext.Version
+		extension["protocolVersion"] = ext.ProtocolVersion
+		extension["capabilities"] = ext.Capabilities
+	}
+	status["extension"] = extension
+	status["cache"] = s.bridge.Cache().Stats()
+	return status
+}
+
+// handleSubscribe changes the event topics a client receives. Events are
+// pushed as {"type":"browser:event","topic":...} lines between responses.
+func (s *SocketServer) handleSubscribe(client *socketClient, msg SocketMessage) SocketResponse {
+	var topics []string
+	if p, ok := msg.Params.(map[string]interface{}); ok {
+		list, _ := p["topics"].([]interface{})
+		for _, t := range list {
+			if topic, ok := t.(string); ok {
+				topics = append(topics, topic)
+			}
+		}
+	}
+
+	if client.subscription == nil {
+		client.subscription = s.bridge.Events().Subscribe()
+		go func(sub *EventSubscription) {
+			for event := range sub.C {
+				if err := client.send(event); err != nil {
+					slog.Debug("[Socket] Failed to push event", "client", client.id, "error", err)
+				}
+			}
+		}(client.subscription)
+	}
+
+	current, err := s.bridge.Events().SetTopics(client.subscription, topics, msg.Type == "subscribe")
+	if err != nil {
+		return SocketResponse{
+			Type:      msg.Type,
+			RequestId: msg.RequestId,
+			Success:   false,
+			Error:     err.Error(),
+		}
+	}
+
+	slog.Info("[Socket] Event subscription changed", "client", client.id, "topics", current)
+	return SocketResponse{
+		Type:      msg.Type,
+		RequestId: msg.RequestId,
+		Success:   true,
+		Data:      map[string]interface{}{"topics": current},
 	}
 }
 
@@ -112,6 +251,7 @@ type SocketMessage struct {
 	RequestId string      `json:"requestId"`
 	Action    string      `json:"action,omitempty"`
 	Params    interface{} `json:"params,omitempty"`
+	Client    string      `json:"client,omitempty"` // self-reported client name, for auditing
 }
 
 // SocketResponse represents a response over the Unix socket
@@ -121,29 +261,99 @@ type SocketResponse struct {
 	Success   bool        `json:"success"`
 	Data      interface{} `json:"data,omitempty"`
 	Error     string      `json:"error,omitempty"`
+	// Cached is set when a read was answered from the response cache
+	Cached bool `json:"cached,omitempty"`
 }
 
-// handleRequest handles a request from an MCP client
-func (s *SocketServer) handleRequest(msg SocketMessage) SocketResponse {
-	log.Printf("[Socket] Handling request: %s (%s)", msg.Action, msg.RequestId)
+// handleRequest handles a request from an MCP client and records it in the audit log
+func (s *SocketServer) handleRequest(msg SocketMessage, clientId string) SocketResponse {
+	slog.Info("[Socket] Handling request", "action", msg.Action, "requestId", msg.RequestId, "client", clientId)
 
-	// Forward to Chrome via the bridge
-	response, err := s.bridge.Request(msg.Action, msg.Params, msg.RequestId)
-	if err != nil {
+	start := time.Now()
+	response, outcome, target := s.dispatch(msg)
+
+	client := clientId
+	if msg.Client != "" {
+		client = clientId + " (" + msg.Client + ")"
+	}
+	entry := AuditEntry{
+		Timestamp:  start,
+		Client:     client,
+		RequestId:  msg.RequestId,
+		Action:     msg.Action,
+		Params:     redactParams(msg.Params),
+		Outcome:    outcome,
+		Error:      response.Error,
+		Cached:     response.Cached,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	// The tab the policy checked, which is also where a pinned action ran;
+	// otherwise whatever page the response names
+	entry.TargetURL = target.URL
+	if data, ok := response.Data.(map[string]interface{}); ok && entry.TargetURL == "" {
+		entry.TargetURL, _ = data["url"].(string)
+	}
+	s.audit.Record(entry)
+	hostMetrics.RecordAction(msg.Action, time.Since(start), response.Success)
+
+	return response
+}
+
+// dispatch runs a request locally or forwards it to Chrome, returning the
+// response, its audit outcome and the tab the policy checked
+func (s *SocketServer) dispatch(msg SocketMessage) (SocketResponse, string, PolicyTarget) {
+	// Actions served by the native host itself
+	if handler, ok := s.localActions[msg.Action]; ok {
+		if err := s.policy.CheckLocal(msg); err != nil {
+			slog.Warn("[Socket] Policy rejected request", "action", msg.Action, "requestId", msg.RequestId, "error", err)
+			return s.errorResponse(msg, err), AuditDenied, PolicyTarget{}
+		}
+		data, err := handler(msg.Params)
+		if err != nil {
+			return s.errorResponse(msg, err), AuditError, PolicyTarget{}
+		}
 		return SocketResponse{
 			Type:      "browser:response",
 			RequestId: msg.RequestId,
-			Success:   false,
-			Error:     err.Error(),
-		}
+			Success:   true,
+			Data:      data,
+		}, AuditSuccess, PolicyTarget{}
 	}
 
+	// Enforce the permission policy before anything reaches Chrome
+	target, err := s.policy.Check(msg)
+	if err != nil {
+		slog.Warn("[Socket] Policy rejected request", "action", msg.Action, "requestId", msg.RequestId, "error", err)
+		return s.errorResponse(msg, err), AuditDenied, target
+	}
+
+	// Forward to Chrome via the bridge, unless the page is unchanged since
+	// the same read
+	response, cached, err := s.bridge.RequestCached(msg.Action, target.Pin(msg.Params), msg.RequestId)
+	if err != nil {
+		return s.errorResponse(msg, err), AuditError, target
+	}
+
+	outcome := AuditSuccess
+	if !response.Success {
+		outcome = AuditError
+	}
 	return SocketResponse{
 		Type:      "browser:response",
 		RequestId: msg.RequestId,
 		Success:   response.Success,
 		Data:      response.Data,
 		Error:     response.Error,
+		Cached:    cached,
+	}, outcome, target
+}
+
+func (s *SocketServer) errorResponse(msg SocketMessage, err error) SocketResponse {
+	return SocketResponse{
+		Type:      "browser:response",
+		RequestId: msg.RequestId,
+		Success:   false,
+		Error:     err.Error(),
 	}
 }
 
@@ -0,0 +1,107 @@
+// Terminal Input
+//
+// Writes keystrokes and pastes to the PTY. Input is queued and written in
+// order by one goroutine; large input goes in small chunks with a pause
+// between them, because a single big write overflows the tty input buffer
+// and Gemini CLI's line editor drops the rest. Pastes are wrapped in
+// bracketed-paste markers when the program has asked for them.
+
+package main
+
+import (
+	"bytes"
+	"time"
+)
+
+const (
+	// inputChunkSize stays under the smallest tty input buffer (1024 bytes
+	// on macOS)
+	inputChunkSize = 512
+	// inputChunkDelay gives the program time to drain the buffer
+	inputChunkDelay = 5 * time.Millisecond
+
+	bracketedPasteStart = "\x1b[200~"
+	bracketedPasteEnd   = "\x1b[201~"
+)
+
+// inputRequest is one queued write. done, if set, receives the result.
+type inputRequest struct {
+	data []byte
+	done chan error
+}
+
+// SendInput queues data for the PTY without waiting for it to be written
+func (p *PTYManager) SendInput(data []byte) {
+	p.inputCh <- inputRequest{data: data}
+}
+
+// Write sends data to the PTY, after any input already queued, and waits
+// until it has been written
+func (p *PTYManager) Write(data []byte) error {
+	done := make(chan error, 1)
+	p.inputCh <- inputRequest{data: data, done: done}
+	return <-done
+}
+
+// pasteData prepares pasted text. Programs that enabled bracketed paste
+// (mode 2004) get it between markers, so newlines don't submit a prompt
+// line by line; an end marker inside the text is removed so the paste
+// can't break out early.
+func (p *PTYManager) pasteData(text []byte) []byte {
+	if !p.screen.Mode(ModeBracketedPaste) {
+		return text
+	}
+	text = bytes.ReplaceAll(text, []byte(bracketedPasteEnd), nil)
+	data := make([]byte, 0, len(text)+len(bracketedPasteStart)+len(bracketedPasteEnd))
+	data = append(data, bracketedPasteStart...)
+	data = append(data, text...)
+	return append(data, bracketedPasteEnd...)
+}
+
+// SendPaste queues pasted text (see pasteData)
+func (p *PTYManager) SendPaste(text []byte) {
+	p.SendInput(p.pasteData(text))
+}
+
+// Paste writes pasted text (see pasteData) and waits until it is written
+func (p *PTYManager) Paste(text []byte) error {
+	return p.Write(p.pasteData(text))
+}
+
+func (p *PTYManager) inputLoop() {
+	for req := range p.inputCh {
+		err := p.writeInput(req.data)
+		if req.done != nil {
+			req.done <- err
+		}
+	}
+}
+
+// writeInput writes data to the current session in chunks
+func (p *PTYManager) writeInput(data []byte) error {
+	p.mutex.Lock()
+	ptmx, recorder := p.ptmx, p.recorder
+	p.mutex.Unlock()
+
+	if ptmx == nil {
+		return nil
+	}
+	if recorder != nil {
+		recorder.Input(data)
+	}
+
+	for len(data) > 0 {
+		n := len(data)
+		if n > inputChunkSize {
+			n = inputChunkSize
+		}
+		if _, err := ptmx.Write(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+		if len(data) > 0 {
+			time.Sleep(inputChunkDelay)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,831 @@
+// Terminal Screen
+//
+// A headless terminal emulator fed with the PTY output, so agents can read
+// what the side panel's xterm.js is showing. It follows the VT100/xterm
+// sequences that affect layout (cursor movement, erasing, insert/delete,
+// scroll regions, the alternate screen, autowrap) and ignores colors and
+// other attributes.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultScrollbackLines is how much scrolled-off output is kept
+	DefaultScrollbackLines = 1000
+	maxOSCLength           = 4096
+	// Smaller screens are enlarged: a wide character needs two columns
+	minScreenCols = 2
+	minScreenRows = 1
+)
+
+// Parser states
+const (
+	vtGround = iota
+	vtEscape
+	vtEscapeCharset // ESC ( and friends take one more character
+	vtCSI
+	vtOSC
+	vtOSCEscape
+	vtString // DCS, SOS, PM, APC: skipped up to ST
+	vtStringEscape
+)
+
+// DEC private modes the screen acts on
+const (
+	modeAutowrap        = 7
+	modeCursorVisible   = 25
+	modeAltScreen       = 47
+	modeAltScreenClear  = 1047
+	modeAltScreenCursor = 1049
+	// ModeBracketedPaste is set by programs that want pastes wrapped in
+	// ESC [200~ ... ESC [201~
+	ModeBracketedPaste = 2004
+)
+
+// screenCell is one character position. A wide character occupies its cell
+// and a continuation cell to the right.
+type screenCell struct {
+	ch   string // empty for a blank
+	cont bool
+}
+
+type screenLine []screenCell
+
+// TerminalScreen keeps the visible screen, cursor and scrollback
+type TerminalScreen struct {
+	cols, rows int
+	lines      []screenLine
+	mainLines  []screenLine // saved while the alternate screen is active
+	altScreen  bool
+	scrollback []screenLine
+	maxBack    int
+
+	x, y     int
+	wrapNext bool // cursor is past the last column; next character wraps
+	top      int  // scroll region
+	bottom   int
+	savedX   int
+	savedY   int
+	modes    map[int]bool
+	title    string
+
+	state   int
+	seq     []byte // CSI parameters and intermediates, or OSC text
+	pending []byte // incomplete UTF-8 sequence from the last Write
+	mutex   sync.Mutex
+}
+
+// ScreenSnapshot is the text content of the screen
+type ScreenSnapshot struct {
+	Cols          int      `json:"cols"`
+	Rows          int      `json:"rows"`
+	CursorRow     int      `json:"cursorRow"` // 1-based
+	CursorCol     int      `json:"cursorCol"` // 1-based
+	CursorVisible bool     `json:"cursorVisible"`
+	AltScreen     bool     `json:"altScreen"`
+	Title         string   `json:"title,omitempty"`
+	Screen        []string `json:"screen"`
+	Scrollback    []string `json:"scrollback,omitempty"`
+}
+
+// NewTerminalScreen creates a blank screen
+func NewTerminalScreen(cols, rows, scrollback int) *TerminalScreen {
+	t := &TerminalScreen{
+		maxBack: scrollback,
+		modes:   map[int]bool{modeAutowrap: true, modeCursorVisible: true},
+	}
+	t.cols, t.rows = max(cols, minScreenCols), max(rows, minScreenRows)
+	cols, rows = t.cols, t.rows
+	t.lines = blankLines(rows, cols)
+	t.bottom = rows - 1
+	return t
+}
+
+func blankLines(rows, cols int) []screenLine {
+	lines := make([]screenLine, rows)
+	for i := range lines {
+		lines[i] = make(screenLine, cols)
+	}
+	return lines
+}
+
+// Write feeds terminal output to the emulator
+func (t *TerminalScreen) Write(data []byte) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.pending) > 0 {
+		data = append(t.pending, data...)
+		t.pending = nil
+	}
+	end := utf8Boundary(data)
+	if end < len(data) {
+		t.pending = append([]byte{}, data[end:]...)
+		data = data[:end]
+	}
+
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		data = data[size:]
+		t.feed(r)
+	}
+}
+
+// Mode reports whether a DEC private mode (e.g. ModeBracketedPaste) is set
+func (t *TerminalScreen) Mode(mode int) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.modes[mode]
+}
+
+// Reset clears the screen and modes, as for a new session
+func (t *TerminalScreen) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.resetLocked()
+}
+
+func (t *TerminalScreen) resetLocked() {
+	t.lines = blankLines(t.rows, t.cols)
+	t.mainLines = nil
+	t.altScreen = false
+	t.x, t.y, t.savedX, t.savedY = 0, 0, 0, 0
+	t.wrapNext = false
+	t.top, t.bottom = 0, t.rows-1
+	t.modes = map[int]bool{modeAutowrap: true, modeCursorVisible: true}
+	t.title = ""
+	t.state = vtGround
+}
+
+func (t *TerminalScreen) feed(r rune) {
+	switch t.state {
+	case vtOSC, vtOSCEscape:
+		t.feedOSC(r)
+		return
+	case vtString, vtStringEscape:
+		// ST (ESC \) ends the string; nothing inside is shown
+		if t.state == vtStringEscape && r == '\\' {
+			t.state = vtGround
+		} else if r == 0x1b {
+			t.state = vtStringEscape
+		} else {
+			t.state = vtString
+		}
+		return
+	}
+
+	// Control characters act even in the middle of a sequence
+	if r < 0x20 {
+		t.control(r)
+		return
+	}
+
+	switch t.state {
+	case vtEscape:
+		t.escape(r)
+	case vtEscapeCharset:
+		t.state = vtGround
+	case vtCSI:
+		if r >= 0x40 && r <= 0x7e {
+			t.csi(r)
+			t.state = vtGround
+		} else if len(t.seq) < 64 {
+			t.seq = append(t.seq, byte(r))
+		}
+	default:
+		if r == 0x7f || (r >= 0x80 && r < 0xa0) {
+			return
+		}
+		t.put(r)
+	}
+}
+
+func (t *TerminalScreen) control(r rune) {
+	switch r {
+	case 0x1b:
+		t.state = vtEscape
+		t.seq = t.seq[:0]
+	case '\b':
+		if t.x > 0 {
+			t.x--
+		}
+		t.wrapNext = false
+	case '\t':
+		t.x = (t.x/8 + 1) * 8
+		if t.x >= t.cols {
+			t.x = t.cols - 1
+		}
+		t.wrapNext = false
+	case '\n', '\v', '\f':
+		t.lineFeed()
+	case '\r':
+		t.x = 0
+		t.wrapNext = false
+	case 0x18, 0x1a:
+		// CAN and SUB abort a sequence
+		t.state = vtGround
+	}
+}
+
+func (t *TerminalScreen) escape(r rune) {
+	t.state = vtGround
+	switch r {
+	case '[':
+		t.state = vtCSI
+	case ']':
+		t.state = vtOSC
+	case 'P', 'X', '^', '_':
+		t.state = vtString
+	case '(', ')', '*', '+', '-', '.', '/', '#', '%', ' ':
+		t.state = vtEscapeCharset
+	case '7':
+		t.saveCursor()
+	case '8':
+		t.restoreCursor()
+	case 'D':
+		t.lineFeed()
+	case 'E':
+		t.x = 0
+		t.lineFeed()
+	case 'M':
+		t.reverseIndex()
+	case 'c':
+		t.resetLocked()
+	}
+}
+
+func (t *TerminalScreen) feedOSC(r rune) {
+	end := false
+	switch {
+	case r == 0x07:
+		end = true
+	case t.state == vtOSCEscape && r == '\\':
+		end = true
+	case r == 0x1b:
+		t.state = vtOSCEscape
+		return
+	}
+	if !end {
+		t.state = vtOSC
+		if len(t.seq) < maxOSCLength {
+			t.seq = utf8.AppendRune(t.seq, r)
+		}
+		return
+	}
+
+	// OSC 0 and 2 set the window title
+	t.state = vtGround
+	if code, text, ok := strings.Cut(string(t.seq), ";"); ok && (code == "0" || code == "2") {
+		t.title = text
+	}
+}
+
+// put prints a character at the cursor
+func (t *TerminalScreen) put(r rune) {
+	width := runeWidth(r)
+	if width == 0 {
+		// Combining marks and joiners belong to the previous character
+		x := t.x
+		if !t.wrapNext {
+			x--
+		}
+		if x >= 0 && x < t.cols {
+			if t.lines[t.y][x].cont && x > 0 {
+				x--
+			}
+			t.lines[t.y][x].ch += string(r)
+		}
+		return
+	}
+
+	if t.wrapNext {
+		t.x = 0
+		t.lineFeed()
+	}
+	if width == 2 && t.x == t.cols-1 {
+		if t.modes[modeAutowrap] {
+			t.clearCells(t.y, t.x, t.x+1)
+			t.x = 0
+			t.lineFeed()
+		} else if t.x > 0 {
+			t.x--
+		}
+	}
+	if width > t.cols-t.x {
+		return
+	}
+
+	t.clearCells(t.y, t.x, t.x+width)
+	t.lines[t.y][t.x] = screenCell{ch: string(r)}
+	if width == 2 {
+		t.lines[t.y][t.x+1] = screenCell{cont: true}
+	}
+
+	t.x += width
+	if t.x >= t.cols {
+		t.x = t.cols - 1
+		t.wrapNext = t.modes[modeAutowrap]
+	}
+}
+
+// clearCells blanks cells [from, to) of a row, including the other half
+// of any wide character cut in two
+func (t *TerminalScreen) clearCells(row, from, to int) {
+	line := t.lines[row]
+	if from < 0 {
+		from = 0
+	}
+	if to > t.cols {
+		to = t.cols
+	}
+	if from >= to {
+		return
+	}
+	if line[from].cont && from > 0 {
+		line[from-1] = screenCell{}
+	}
+	if to < t.cols && line[to].cont {
+		line[to] = screenCell{}
+	}
+	for i := from; i < to; i++ {
+		line[i] = screenCell{}
+	}
+}
+
+func (t *TerminalScreen) lineFeed() {
+	t.wrapNext = false
+	if t.y == t.bottom {
+		t.scrollUp(1)
+	} else if t.y < t.rows-1 {
+		t.y++
+	}
+}
+
+func (t *TerminalScreen) reverseIndex() {
+	t.wrapNext = false
+	if t.y == t.top {
+		t.scrollDown(1)
+	} else if t.y > 0 {
+		t.y--
+	}
+}
+
+// scrollUp moves the scroll region up n lines. Lines leaving the top of
+// the main screen go to the scrollback.
+func (t *TerminalScreen) scrollUp(n int) {
+	height := t.bottom - t.top + 1
+	if n > height {
+		n = height
+	}
+	if t.top == 0 && !t.altScreen && t.maxBack > 0 {
+		t.scrollback = append(t.scrollback, t.lines[:n]...)
+		if over := len(t.scrollback) - t.maxBack; over > 0 {
+			t.scrollback = append([]screenLine{}, t.scrollback[over:]...)
+		}
+	}
+	region := t.lines[t.top : t.bottom+1]
+	copy(region, region[n:])
+	for i := height - n; i < height; i++ {
+		region[i] = make(screenLine, t.cols)
+	}
+}
+
+// scrollDown moves the scroll region down n lines
+func (t *TerminalScreen) scrollDown(n int) {
+	height := t.bottom - t.top + 1
+	if n > height {
+		n = height
+	}
+	region := t.lines[t.top : t.bottom+1]
+	copy(region[n:], region[:height-n])
+	for i := 0; i < n; i++ {
+		region[i] = make(screenLine, t.cols)
+	}
+}
+
+func (t *TerminalScreen) saveCursor() {
+	t.savedX, t.savedY = t.x, t.y
+}
+
+func (t *TerminalScreen) restoreCursor() {
+	t.x, t.y = t.savedX, t.savedY
+	t.clampCursor()
+}
+
+func (t *TerminalScreen) clampCursor() {
+	t.wrapNext = false
+	if t.x >= t.cols {
+		t.x = t.cols - 1
+	}
+	if t.y >= t.rows {
+		t.y = t.rows - 1
+	}
+	if t.x < 0 {
+		t.x = 0
+	}
+	if t.y < 0 {
+		t.y = 0
+	}
+}
+
+// csi executes a control sequence with the given final character
+func (t *TerminalScreen) csi(final rune) {
+	seq := string(t.seq)
+	private := ""
+	if seq != "" && strings.ContainsRune("?>=<", rune(seq[0])) {
+		private, seq = seq[:1], seq[1:]
+	}
+	// Sequences with intermediates (e.g. DECSCUSR "CSI 2 SP q") don't
+	// affect the text
+	if strings.IndexFunc(seq, func(r rune) bool { return r >= 0x20 && r <= 0x2f }) >= 0 {
+		return
+	}
+	params := parseParams(seq)
+	arg := func(i, def int) int {
+		if i < len(params) && params[i] > 0 {
+			return params[i]
+		}
+		return def
+	}
+
+	if private == "?" {
+		if final == 'h' || final == 'l' {
+			for _, mode := range params {
+				t.setMode(mode, final == 'h')
+			}
+		}
+		return
+	}
+	if private != "" {
+		return
+	}
+
+	n := arg(0, 1)
+	switch final {
+	case 'A':
+		t.y -= n
+		if t.y < t.top && t.y+n >= t.top {
+			t.y = t.top
+		}
+		t.clampCursor()
+	case 'B', 'e':
+		t.y += n
+		if t.y > t.bottom && t.y-n <= t.bottom {
+			t.y = t.bottom
+		}
+		t.clampCursor()
+	case 'C', 'a':
+		t.x += n
+		t.clampCursor()
+	case 'D':
+		t.x -= n
+		t.clampCursor()
+	case 'E':
+		t.x, t.y = 0, t.y+n
+		t.clampCursor()
+	case 'F':
+		t.x, t.y = 0, t.y-n
+		t.clampCursor()
+	case 'G', '`':
+		t.x = n - 1
+		t.clampCursor()
+	case 'd':
+		t.y = n - 1
+		t.clampCursor()
+	case 'H', 'f':
+		t.y, t.x = arg(0, 1)-1, arg(1, 1)-1
+		t.clampCursor()
+	case 'J':
+		t.eraseDisplay(arg(0, 0))
+	case 'K':
+		t.eraseLine(arg(0, 0))
+	case '@':
+		t.insertChars(n)
+	case 'P':
+		t.deleteChars(n)
+	case 'X':
+		t.clearCells(t.y, t.x, t.x+n)
+		t.wrapNext = false
+	case 'L':
+		t.insertLines(n)
+	case 'M':
+		t.deleteLines(n)
+	case 'S':
+		t.scrollUp(n)
+	case 'T':
+		if len(params) <= 1 {
+			t.scrollDown(n)
+		}
+	case 'r':
+		top, bottom := arg(0, 1)-1, arg(1, t.rows)-1
+		if bottom >= t.rows {
+			bottom = t.rows - 1
+		}
+		if top < bottom {
+			t.top, t.bottom = top, bottom
+			t.x, t.y = 0, 0
+			t.wrapNext = false
+		}
+	case 's':
+		t.saveCursor()
+	case 'u':
+		t.restoreCursor()
+	}
+}
+
+func parseParams(seq string) []int {
+	if seq == "" {
+		return nil
+	}
+	parts := strings.Split(seq, ";")
+	params := make([]int, len(parts))
+	for i, part := range parts {
+		// Sub-parameters (38:2:...) only matter for colors
+		part, _, _ = strings.Cut(part, ":")
+		params[i], _ = strconv.Atoi(part)
+	}
+	return params
+}
+
+func (t *TerminalScreen) setMode(mode int, on bool) {
+	switch mode {
+	case modeAltScreen, modeAltScreenClear, modeAltScreenCursor:
+		if on == t.altScreen {
+			break
+		}
+		if on {
+			if mode == modeAltScreenCursor {
+				t.saveCursor()
+			}
+			t.mainLines = t.lines
+			t.lines = blankLines(t.rows, t.cols)
+			t.altScreen = true
+		} else {
+			t.lines = t.mainLines
+			t.mainLines = nil
+			t.altScreen = false
+			if mode == modeAltScreenCursor {
+				t.restoreCursor()
+			}
+		}
+		t.wrapNext = false
+	}
+	t.modes[mode] = on
+}
+
+func (t *TerminalScreen) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		t.clearCells(t.y, t.x, t.cols)
+		for row := t.y + 1; row < t.rows; row++ {
+			t.clearCells(row, 0, t.cols)
+		}
+	case 1:
+		t.clearCells(t.y, 0, t.x+1)
+		for row := 0; row < t.y; row++ {
+			t.clearCells(row, 0, t.cols)
+		}
+	case 2:
+		for row := 0; row < t.rows; row++ {
+			t.clearCells(row, 0, t.cols)
+		}
+	case 3:
+		t.scrollback = nil
+	}
+	t.wrapNext = false
+}
+
+func (t *TerminalScreen) eraseLine(mode int) {
+	switch mode {
+	case 0:
+		t.clearCells(t.y, t.x, t.cols)
+	case 1:
+		t.clearCells(t.y, 0, t.x+1)
+	case 2:
+		t.clearCells(t.y, 0, t.cols)
+	}
+	t.wrapNext = false
+}
+
+func (t *TerminalScreen) insertChars(n int) {
+	line := t.lines[t.y]
+	if n > t.cols-t.x {
+		n = t.cols - t.x
+	}
+	t.clearCells(t.y, t.cols-n, t.cols)
+	copy(line[t.x+n:], line[t.x:t.cols-n])
+	t.clearCells(t.y, t.x, t.x+n)
+	t.wrapNext = false
+}
+
+func (t *TerminalScreen) deleteChars(n int) {
+	line := t.lines[t.y]
+	if n > t.cols-t.x {
+		n = t.cols - t.x
+	}
+	t.clearCells(t.y, t.x, t.x+n)
+	copy(line[t.x:], line[t.x+n:])
+	for i := t.cols - n; i < t.cols; i++ {
+		line[i] = screenCell{}
+	}
+	t.wrapNext = false
+}
+
+// insertLines and deleteLines work inside the scroll region, from the
+// cursor row down
+func (t *TerminalScreen) insertLines(n int) {
+	if t.y < t.top || t.y > t.bottom {
+		return
+	}
+	top := t.top
+	t.top = t.y
+	t.scrollDown(n)
+	t.top = top
+	t.x = 0
+	t.wrapNext = false
+}
+
+func (t *TerminalScreen) deleteLines(n int) {
+	if t.y < t.top || t.y > t.bottom {
+		return
+	}
+	top := t.top
+	t.top = t.y
+	// Lines deleted mid-screen are not scrollback
+	back := t.maxBack
+	t.maxBack = 0
+	t.scrollUp(n)
+	t.maxBack = back
+	t.top = top
+	t.x = 0
+	t.wrapNext = false
+}
+
+// Resize changes the screen size without reflowing text. When the screen
+// gets shorter, lines above the cursor move to the scrollback.
+func (t *TerminalScreen) Resize(cols, rows int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if cols <= 0 || rows <= 0 {
+		return
+	}
+	cols, rows = max(cols, minScreenCols), max(rows, minScreenRows)
+	if cols == t.cols && rows == t.rows {
+		return
+	}
+
+	shift := 0
+	if t.y >= rows {
+		shift = t.y - rows + 1
+	}
+	if !t.altScreen && shift > 0 && t.maxBack > 0 {
+		t.scrollback = append(t.scrollback, t.lines[:shift]...)
+		if over := len(t.scrollback) - t.maxBack; over > 0 {
+			t.scrollback = append([]screenLine{}, t.scrollback[over:]...)
+		}
+	}
+	t.lines = resizeLines(t.lines[shift:], cols, rows)
+	if t.mainLines != nil {
+		t.mainLines = resizeLines(t.mainLines, cols, rows)
+	}
+
+	t.cols, t.rows = cols, rows
+	t.y -= shift
+	t.top, t.bottom = 0, rows-1
+	t.clampCursor()
+}
+
+func resizeLines(lines []screenLine, cols, rows int) []screenLine {
+	resized := blankLines(rows, cols)
+	for i := 0; i < rows && i < len(lines); i++ {
+		copy(resized[i], lines[i])
+		// A wide character cut at the new right edge becomes a blank
+		if last := resized[i][cols-1]; last.ch != "" && runeWidth([]rune(last.ch)[0]) == 2 {
+			resized[i][cols-1] = screenCell{}
+		}
+	}
+	return resized
+}
+
+// Snapshot returns the screen as text, with up to scrollbackLines lines of
+// scrollback. Trailing spaces and blank lines at the bottom are trimmed.
+func (t *TerminalScreen) Snapshot(scrollbackLines int) ScreenSnapshot {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	snapshot := ScreenSnapshot{
+		Cols:          t.cols,
+		Rows:          t.rows,
+		CursorRow:     t.y + 1,
+		CursorCol:     t.x + 1,
+		CursorVisible: t.modes[modeCursorVisible],
+		AltScreen:     t.altScreen,
+		Title:         t.title,
+	}
+
+	snapshot.Screen = linesText(t.lines)
+	last := len(snapshot.Screen)
+	for last > 0 && snapshot.Screen[last-1] == "" {
+		last--
+	}
+	snapshot.Screen = snapshot.Screen[:last]
+
+	if scrollbackLines > 0 {
+		from := len(t.scrollback) - scrollbackLines
+		if from < 0 {
+			from = 0
+		}
+		snapshot.Scrollback = linesText(t.scrollback[from:])
+	}
+	return snapshot
+}
+
+func linesText(lines []screenLine) []string {
+	text := make([]string, len(lines))
+	for i, line := range lines {
+		var b strings.Builder
+		for _, cell := range line {
+			switch {
+			case cell.cont:
+			case cell.ch == "":
+				b.WriteByte(' ')
+			default:
+				b.WriteString(cell.ch)
+			}
+		}
+		text[i] = strings.TrimRight(b.String(), " ")
+	}
+	return text
+}
+
+// runeWidth returns how many cells r takes: 0 for combining marks and
+// joiners, 2 for East Asian wide characters and emoji, 1 otherwise. This
+// follows the Unicode 6 widths xterm.js uses by default.
+func runeWidth(r rune) int {
+	switch {
+	case r == 0x200b || r == 0x200c || r == 0x200d || r == 0x2060 || r == 0xfeff:
+		return 0
+	case unicode.In(r, unicode.Mn, unicode.Me):
+		return 0
+	case r >= 0x1100 && r <= 0x115f,
+		r >= 0x2e80 && r <= 0x303e,
+		r >= 0x3041 && r <= 0x33ff,
+		r >= 0x3400 && r <= 0x4dbf,
+		r >= 0x4e00 && r <= 0x9fff,
+		r >= 0xa000 && r <= 0xa4cf,
+		r >= 0xac00 && r <= 0xd7a3,
+		r >= 0xf900 && r <= 0xfaff,
+		r >= 0xfe30 && r <= 0xfe4f,
+		r >= 0xff00 && r <= 0xff60,
+		r >= 0xffe0 && r <= 0xffe6,
+		r >= 0x1f300 && r <= 0x1f64f,
+		r >= 0x1f680 && r <= 0x1f6ff,
+		r >= 0x1f900 && r <= 0x1f9ff,
+		r >= 0x1fa70 && r <= 0x1faff,
+		r >= 0x20000 && r <= 0x3fffd:
+		return 2
+	}
+	return 1
+}
+
+// formatTerminalScreen renders a getTerminalScreen result as plain text
+func formatTerminalScreen(data interface{}) string {
+	var result struct {
+		Running  bool           `json:"running"`
+		Profile  string         `json:"profile"`
+		Snapshot ScreenSnapshot `json:"snapshot"`
+	}
+	raw, _ := json.Marshal(data)
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return string(raw)
+	}
+	snap := result.Snapshot
+
+	var b strings.Builder
+	state := "running"
+	if !result.Running {
+		state = "not running"
+	}
+	fmt.Fprintf(&b, "Terminal: %s (%s), %dx%d, cursor at row %d, column %d", result.Profile, state, snap.Cols, snap.Rows, snap.CursorRow, snap.CursorCol)
+	if snap.AltScreen {
+		b.WriteString(", full-screen app")
+	}
+	if snap.Title != "" {
+		fmt.Fprintf(&b, "\nTitle: %s", snap.Title)
+	}
+	if len(snap.Scrollback) > 0 {
+		fmt.Fprintf(&b, "\n\n--- scrollback (last %d lines) ---\n%s", len(snap.Scrollback), strings.Join(snap.Scrollback, "\n"))
+	}
+	fmt.Fprintf(&b, "\n\n--- screen ---\n%s\n", strings.Join(snap.Screen, "\n"))
+	return b.String()
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTerminalScreen(t *testing.T) {
+	tests := []struct {
+		name       string
+		cols, rows int
+		input      string
+		screen     []string
+		scrollback []string
+		row, col   int // expected cursor, 1-based
+	}{
+		// Cursor movement
+		{
+			name: "absolute position", cols: 10, rows: 3,
+			input:  "abc\x1b[2;5Hx",
+			screen: []string{"abc", "    x"}, row: 2, col: 6,
+		},
+		{
+			name: "relative moves", cols: 10, rows: 3,
+			input:  "\x1b[3;3H\x1b[Ax\x1b[2Dy\x1b[Bz\x1b[3Cw",
+			screen: []string{"", " yx", "  z   w"}, row: 3, col: 8,
+		},
+		{
+			name: "moves clamp to the screen", cols: 5, rows: 2,
+			input:  "\x1b[10A\x1b[10Dx\x1b[99;99Hy",
+			screen: []string{"x", "    y"}, row: 2, col: 5,
+		},
+		{
+			name: "column and row absolute", cols: 10, rows: 3,
+			input:  "\x1b[4Ga\x1b[3db",
+			screen: []string{"   a", "", "    b"}, row: 3, col: 6,
+		},
+		{
+			name: "carriage return and backspace", cols: 10, rows: 2,
+			input:  "hello\rj\b\bx",
+			screen: []string{"xello"}, row: 1, col: 2,
+		},
+		{
+			name: "tab stops", cols: 20, rows: 1,
+			input:  "a\tb\tc",
+			screen: []string{"a       b       c"}, row: 1, col: 18,
+		},
+		{
+			name: "save and restore cursor", cols: 10, rows: 2,
+			input:  "ab\x1b7\x1b[2;8Hx\x1b8c",
+			screen: []string{"abc", "       x"}, row: 1, col: 4,
+		},
+
+		// Wrapping
+		{
+			name: "autowrap", cols: 5, rows: 3,
+			input:  "abcdefg",
+			screen: []string{"abcde", "fg"}, row: 2, col: 3,
+		},
+		{
+			name: "cursor stays on the last column until the next character", cols: 5, rows: 3,
+			input:  "abcde",
+			screen: []string{"abcde"}, row: 1, col: 5,
+		},
+		{
+			name: "carriage return cancels a pending wrap", cols: 5, rows: 3,
+			input:  "abcde\rX",
+			screen: []string{"Xbcde"}, row: 1, col: 2,
+		},
+		{
+			name: "autowrap off overwrites the last column", cols: 5, rows: 2,
+			input:  "\x1b[?7labcdefg",
+			screen: []string{"abcdg"}, row: 1, col: 5,
+		},
+
+		// Scrolling
+		{
+			name: "scrolls into scrollback", cols: 5, rows: 3,
+			input:  "1\r\n2\r\n3\r\n4",
+			screen: []string{"2", "3", "4"}, scrollback: []string{"1"}, row: 3, col: 2,
+		},
+		{
+			name: "scroll region keeps lines outside it", cols: 5, rows: 4,
+			input:  "A\r\nB\r\nC\r\nD\x1b[2;3r\x1b[3;1H\n",
+			screen: []string{"A", "C", "", "D"}, row: 3, col: 1,
+		},
+		{
+			name: "reverse index at the top scrolls down", cols: 5, rows: 3,
+			input:  "A\r\nB\x1b[1;1H\x1bM",
+			screen: []string{"", "A", "B"}, row: 1, col: 1,
+		},
+		{
+			name: "scroll up and down", cols: 5, rows: 3,
+			input:  "A\r\nB\r\nC\x1b[S",
+			screen: []string{"B", "C"}, scrollback: []string{"A"}, row: 3, col: 2,
+		},
+		{
+			name: "insert and delete lines", cols: 5, rows: 4,
+			input:  "A\r\nB\r\nC\x1b[2;1H\x1b[L\x1b[4;1H\x1b[M",
+			screen: []string{"A", "", "B"}, row: 4, col: 1,
+		},
+
+		// Erasing
+		{
+			name: "erase to end of line", cols: 10, rows: 1,
+			input:  "abcdef\x1b[1;3H\x1b[K",
+			screen: []string{"ab"}, row: 1, col: 3,
+		},
+		{
+			name: "erase to start of line", cols: 10, rows: 1,
+			input:  "abcdef\x1b[1;3H\x1b[1K",
+			screen: []string{"   def"}, row: 1, col: 3,
+		},
+		{
+			name: "erase whole line", cols: 10, rows: 2,
+			input:  "abc\r\ndef\x1b[2K",
+			screen: []string{"abc"}, row: 2, col: 4,
+		},
+		{
+			name: "erase below", cols: 10, rows: 3,
+			input:  "abc\r\ndef\r\nghi\x1b[2;2H\x1b[J",
+			screen: []string{"abc", "d"}, row: 2, col: 2,
+		},
+		{
+			name: "erase above", cols: 10, rows: 3,
+			input:  "abc\r\ndef\r\nghi\x1b[2;2H\x1b[1J",
+			screen: []string{"", "  f", "ghi"}, row: 2, col: 2,
+		},
+		{
+			name: "erase display", cols: 10, rows: 2,
+			input:  "abc\r\ndef\x1b[2J",
+			screen: []string{}, row: 2, col: 4,
+		},
+		{
+			name: "erase characters", cols: 10, rows: 1,
+			input:  "abcdef\x1b[1;2H\x1b[2X",
+			screen: []string{"a  def"}, row: 1, col: 2,
+		},
+		{
+			name: "insert and delete characters", cols: 10, rows: 2,
+			input:  "abcdef\x1b[1;2H\x1b[2@\r\nabcdef\x1b[2;2H\x1b[2P",
+			screen: []string{"a  bcdef", "adef"}, row: 2, col: 2,
+		},
+
+		// Wide and combining characters
+		{
+			name: "wide characters take two columns", cols: 10, rows: 1,
+			input:  "漢字x",
+			screen: []string{"漢字x"}, row: 1, col: 6,
+		},
+		{
+			name: "wide character wraps instead of splitting", cols: 5, rows: 2,
+			input:  "abcd漢",
+			screen: []string{"abcd", "漢"}, row: 2, col: 3,
+		},
+		{
+			name: "wide character without autowrap goes in the last two columns", cols: 5, rows: 1,
+			input:  "\x1b[?7labcd漢",
+			screen: []string{"abc漢"}, row: 1, col: 5,
+		},
+		{
+			name: "overwriting half a wide character blanks the other half", cols: 10, rows: 1,
+			input:  "漢字\x1b[1;2Hx",
+			screen: []string{" x字"}, row: 1, col: 3,
+		},
+		{
+			name: "combining mark joins the previous character", cols: 10, rows: 1,
+			input:  "éx",
+			screen: []string{"éx"}, row: 1, col: 3,
+		},
+
+		// Modes and strings
+		{
+			name: "alternate screen restores the main screen", cols: 10, rows: 2,
+			input:  "main\x1b[?1049h\x1b[Hfull-screen\x1b[?1049l",
+			screen: []string{"main"}, row: 1, col: 5,
+		},
+		{
+			name: "colors, titles and DCS strings are not shown", cols: 20, rows: 1,
+			input:  "\x1b[1;31mred\x1b[0m\x1b]0;title\x07\x1bPq#0\x1b\\!",
+			screen: []string{"red!"}, row: 1, col: 5,
+		},
+		{
+			name: "too narrow screens are enlarged", cols: 1, rows: 1,
+			input:  "\x1b[?7l漢字",
+			screen: []string{"字"}, row: 1, col: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			screen := NewTerminalScreen(tt.cols, tt.rows, 100)
+			screen.Write([]byte(tt.input))
+			snap := screen.Snapshot(100)
+
+			if !equalLines(snap.Screen, tt.screen) {
+				t.Errorf("screen = %q, want %q", snap.Screen, tt.screen)
+			}
+			if !equalLines(snap.Scrollback, tt.scrollback) {
+				t.Errorf("scrollback = %q, want %q", snap.Scrollback, tt.scrollback)
+			}
+			if snap.CursorRow != tt.row || snap.CursorCol != tt.col {
+				t.Errorf("cursor at %d,%d, want %d,%d", snap.CursorRow, snap.CursorCol, tt.row, tt.col)
+			}
+		})
+	}
+}
+
+// equalLines treats nil and empty as the same
+func equalLines(got, want []string) bool {
+	return len(got) == len(want) && (len(got) == 0 || reflect.DeepEqual(got, want))
+}
+
+func TestTerminalScreenSplitWrites(t *testing.T) {
+	input := "\x1b[2;3Hé漢\x1b]2;title\x07x"
+	whole := NewTerminalScreen(10, 3, 0)
+	whole.Write([]byte(input))
+
+	split := NewTerminalScreen(10, 3, 0)
+	for i := 0; i < len(input); i++ {
+		split.Write([]byte{input[i]})
+	}
+
+	if got, want := split.Snapshot(0), whole.Snapshot(0); !reflect.DeepEqual(got, want) {
+		t.Errorf("byte-by-byte writes gave %+v, want %+v", got, want)
+	}
+}
+
+func TestTerminalScreenResize(t *testing.T) {
+	screen := NewTerminalScreen(10, 4, 100)
+	screen.Write([]byte("1\r\n2\r\n3\r\n4"))
+	screen.Resize(3, 2)
+
+	snap := screen.Snapshot(100)
+	if want := []string{"3", "4"}; !equalLines(snap.Screen, want) {
+		t.Errorf("screen = %q, want %q", snap.Screen, want)
+	}
+	if want := []string{"1", "2"}; !equalLines(snap.Scrollback, want) {
+		t.Errorf("scrollback = %q, want %q", snap.Scrollback, want)
+	}
+	if snap.CursorRow != 2 || snap.CursorCol != 2 {
+		t.Errorf("cursor at %d,%d, want 2,2", snap.CursorRow, snap.CursorCol)
+	}
+
+	// Wide characters cut at the new edge are dropped, not split
+	screen = NewTerminalScreen(10, 1, 0)
+	screen.Write([]byte("ab漢"))
+	screen.Resize(3, 1)
+	if snap := screen.Snapshot(0); !equalLines(snap.Screen, []string{"ab"}) {
+		t.Errorf("screen = %q, want [\"ab\"]", snap.Screen)
+	}
+}
+
+func FuzzTerminalScreen(f *testing.F) {
+	f.Add([]byte("hello\r\nworld"), uint8(80), uint8(24), uint8(0), uint8(0))
+	f.Add([]byte("\x1b[?7l漢字\x1b[2;3r\x1b[5L\x1b[3M"), uint8(1), uint8(1), uint8(3), uint8(2))
+	f.Add([]byte("\x1b[?1049h\x1b[99;99H🎉\x1b[@\x1b[P\x1b[10X\x1b[?1049l"), uint8(5), uint8(3), uint8(2), uint8(7))
+	f.Add([]byte("é\x1bM\x1b7\x1b[S\x1b[T\x1b8\x1b[J\x1b[1K"), uint8(2), uint8(2), uint8(1), uint8(1))
+
+	f.Fuzz(func(t *testing.T, data []byte, cols, rows, newCols, newRows uint8) {
+		screen := NewTerminalScreen(int(cols), int(rows), 10)
+		half := len(data) / 2
+		screen.Write(data[:half])
+		screen.Resize(int(newCols), int(newRows))
+		screen.Write(data[half:])
+
+		snap := screen.Snapshot(10)
+		if snap.CursorRow < 1 || snap.CursorRow > snap.Rows || snap.CursorCol < 1 || snap.CursorCol > snap.Cols {
+			t.Fatalf("cursor at %d,%d outside %dx%d screen", snap.CursorRow, snap.CursorCol, snap.Cols, snap.Rows)
+		}
+		if len(snap.Screen) > snap.Rows {
+			t.Fatalf("%d lines on a %d-row screen", len(snap.Screen), snap.Rows)
+		}
+		if len(snap.Scrollback) > 10 {
+			t.Fatalf("%d lines of scrollback, want at most 10", len(snap.Scrollback))
+		}
+	})
+}
@@ -0,0 +1,113 @@
+// Workspaces
+//
+// Project directories the terminal can be started in. Configured
+// workspaces are offered in the side panel, and the last one picked is
+// remembered across restarts so Gemini CLI starts next to the project's
+// GEMINI.md instead of wherever Chrome was launched from.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// StateFileName holds host state that survives restarts
+const StateFileName = "state.json"
+
+// HostState is persisted in the install directory
+type HostState struct {
+	LastWorkspace string `json:"lastWorkspace,omitempty"`
+}
+
+// StatePath returns the path of the state file
+func StatePath() string {
+	return filepath.Join(GetInstallDir(), StateFileName)
+}
+
+// LoadState reads the state file. A missing or unreadable file yields an
+// empty state.
+func LoadState() HostState {
+	var state HostState
+	data, err := os.ReadFile(StatePath())
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		slog.Warn("[Workspace] Ignoring invalid state file", "path", StatePath(), "error", err)
+	}
+	return state
+}
+
+// SaveState writes the state file
+func SaveState(state HostState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(GetInstallDir(), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(StatePath(), data, true)
+}
+
+// validateWorkspace expands ~ and checks that dir is an existing directory,
+// returning its absolute path
+func validateWorkspace(dir string) (string, error) {
+	abs, err := filepath.Abs(expandHome(dir))
+	if err != nil {
+		return "", fmt.Errorf("invalid directory %q: %w", dir, err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("directory %s does not exist", abs)
+		}
+		return "", fmt.Errorf("cannot use directory %s: %w", abs, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", abs)
+	}
+	return abs, nil
+}
+
+// resolveWorkspace picks the directory for a new session: the requested
+// one, then the profile's, then the last workspace used, then the home
+// directory
+func resolveWorkspace(requested string, profile LaunchProfile) (string, error) {
+	if requested != "" {
+		return validateWorkspace(requested)
+	}
+	if profile.Cwd != "" {
+		return validateWorkspace(profile.Cwd)
+	}
+	if last := LoadState().LastWorkspace; last != "" {
+		if dir, err := validateWorkspace(last); err == nil {
+			return dir, nil
+		}
+		slog.Warn("[Workspace] Last workspace is gone, using home directory", "path", last)
+	}
+	return os.UserHomeDir()
+}
+
+// WorkspaceList returns the configured workspaces that exist, followed by
+// the last workspace used if it isn't one of them
+func (c TerminalConfig) WorkspaceList() []string {
+	seen := make(map[string]bool)
+	var list []string
+	for _, dir := range append(append([]string{}, c.Workspaces...), LoadState().LastWorkspace) {
+		if dir == "" {
+			continue
+		}
+		abs, err := validateWorkspace(dir)
+		if err != nil || seen[abs] {
+			continue
+		}
+		seen[abs] = true
+		list = append(list, abs)
+	}
+	return list
+}